@@ -0,0 +1,376 @@
+package builder
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ManifestFile is the name of the file in the output dir that maps the
+// source paths of public assets to their output paths and integrities.
+const ManifestFile = "manifest.json"
+
+const (
+	// DefaultHashAlgorithm is the algorithm used for content hashes in file
+	// names if none is configured.
+	DefaultHashAlgorithm = "md5"
+	// DefaultHashLength is the number of hex characters of content hashes
+	// used in file names if none is configured.
+	DefaultHashLength = 8
+)
+
+var (
+	errCircularAssetRef = errors.New("circular asset reference")
+	errManifestConflict = errors.New("manifest conflicts with a public asset")
+)
+
+// hashFuncs are the supported algorithms for content hashes in file names.
+var hashFuncs = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// manifestEntry is the value of an asset in the manifest.
+type manifestEntry struct {
+	File      string `json:"file"`
+	Integrity string `json:"integrity"`
+}
+
+var (
+	// cssRefRegexp matches url() and @import references in CSS.
+	cssRefRegexp = regexp.MustCompile(
+		`url\(\s*(?:"([^"]*)"|'([^']*)'|([^"'()\s]+))\s*\)|@import\s+(?:"([^"]*)"|'([^']*)')`)
+	// jsRefRegexp matches static and dynamic import specifiers in JS.
+	jsRefRegexp = regexp.MustCompile(
+		`\b(?:import|export)\s*(?:[\w$*{},\s]*?\bfrom\s*)?(?:"([^"\n]*)"|'([^'\n]*)')|\bimport\(\s*(?:"([^"\n]*)"|'([^'\n]*)')\s*\)`)
+)
+
+// asset is a file in the public directory.
+type asset struct {
+	// path is the path of the source file
+	path string
+	// key is the path of the file relative to the public dir
+	key string
+	// content is the content of the file. It is only read up front for
+	// files that are transformed or may reference other assets.
+	content []byte
+	refs    []assetRef
+}
+
+// assetRef is a reference from one asset to another.
+type assetRef struct {
+	// start and end are the location of the reference in the content of
+	// the referencing asset
+	start, end int
+	// key is the key of the referenced asset
+	key string
+}
+
+// gatherAssets walks the public dir, creates the corresponding directories
+// in the output dir, and returns the assets it contains in walk order.
+func (b *Builder) gatherAssets() ([]*asset, error) {
+	assets := make([]*asset, 0)
+
+	err := filepath.Walk(b.config.PublicDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Create a corresponding directory in the $b.config.OutputDir
+		if info.IsDir() {
+			// The output dir itself already exists
+			if path == b.config.PublicDir {
+				return nil
+			}
+
+			return b.mkOutDir(b.config.PublicDir, path)
+		}
+
+		// Keys are relative to $b.config.PublicDir
+		key := relPath(b.config.PublicDir, path)
+
+		// Partials are only included in other files
+		if b.isPartial(key) {
+			return nil
+		}
+
+		assets = append(assets, &asset{path: path, key: key})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking public dir: %w", err)
+	}
+
+	keys := make(map[string]bool)
+	for _, a := range assets {
+		keys[a.key] = true
+	}
+
+	for _, a := range assets {
+		re := b.refRegexp(a.path)
+		if re == nil && !b.isTransformed(a.key) {
+			continue
+		}
+
+		a.content, err = ioutil.ReadFile(a.path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file %q: %w", a.path, err)
+		}
+
+		a.content, err = b.transform(a.key, a.path, a.content)
+		if err != nil {
+			return nil, err
+		}
+
+		if re != nil {
+			a.refs = findAssetRefs(re, a.key, a.content, keys)
+		}
+	}
+
+	return assets, nil
+}
+
+// refRegexp returns the regexp that matches references to other assets in
+// the file at path, or nil if references in the file are not rewritten.
+func (b *Builder) refRegexp(path string) *regexp.Regexp {
+	switch filepath.Ext(path) {
+	case ".css":
+		return cssRefRegexp
+	case ".js", ".mjs":
+		if b.config.RewriteJS {
+			return jsRefRegexp
+		}
+	}
+
+	return nil
+}
+
+// findAssetRefs returns the references matched by re in content that refer
+// to one of keys. Relative references are resolved against the directory
+// of key.
+func findAssetRefs(re *regexp.Regexp, key string, content []byte, keys map[string]bool) []assetRef {
+	refs := make([]assetRef, 0)
+
+	for _, m := range re.FindAllSubmatchIndex(content, -1) {
+		// The reference is in whichever group matched
+		start, end := -1, -1
+		for i := 2; i < len(m); i += 2 {
+			if m[i] >= 0 {
+				start, end = m[i], m[i+1]
+				break
+			}
+		}
+
+		if start < 0 {
+			continue
+		}
+
+		u, err := url.Parse(string(content[start:end]))
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+			continue
+		}
+
+		var target string
+		if strings.HasPrefix(u.Path, "/") {
+			target = filepath.FromSlash(strings.TrimPrefix(u.Path, "/"))
+		} else {
+			target = filepath.Join(filepath.Dir(key), filepath.FromSlash(u.Path))
+		}
+
+		if keys[target] {
+			refs = append(refs, assetRef{start: start, end: end, key: target})
+		}
+	}
+
+	return refs
+}
+
+// sortAssets orders assets so that every asset comes after the assets it
+// references. Otherwise, the order of assets is preserved.
+func sortAssets(assets []*asset) ([]*asset, error) {
+	byKey := make(map[string]*asset)
+	for _, a := range assets {
+		byKey[a.key] = a
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int)
+	sorted := make([]*asset, 0, len(assets))
+
+	var visit func(a *asset) error
+	visit = func(a *asset) error {
+		switch state[a.key] {
+		case visiting:
+			return fmt.Errorf("%w: %q", errCircularAssetRef, a.path)
+		case visited:
+			return nil
+		}
+
+		state[a.key] = visiting
+
+		for _, ref := range a.refs {
+			if ref.key == a.key {
+				continue
+			}
+
+			err := visit(byKey[ref.key])
+			if err != nil {
+				return err
+			}
+		}
+
+		state[a.key] = visited
+		sorted = append(sorted, a)
+
+		return nil
+	}
+
+	for _, a := range assets {
+		err := visit(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// rewriteAssetRefs returns a copy of content in which the file name of
+// each reference is replaced with the file name of the output of the
+// referenced asset in publicAssets. If absolute is true, the whole path of
+// each reference is replaced with the output URL instead, which is needed
+// when content is moved to another directory.
+func rewriteAssetRefs(content []byte, refs []assetRef, publicAssets map[string]string, absolute bool) []byte {
+	out := make([]byte, 0, len(content))
+	last := 0
+
+	for _, ref := range refs {
+		outURL, ok := publicAssets[ref.key]
+		if !ok {
+			continue
+		}
+
+		// Keep the directory part of the reference as well as any query
+		// or fragment, such as the ones used by some font declarations
+		orig := string(content[ref.start:ref.end])
+		suffix := ""
+		if i := strings.IndexAny(orig, "?#"); i >= 0 {
+			orig, suffix = orig[:i], orig[i:]
+		}
+
+		out = append(out, content[last:ref.start]...)
+		if absolute {
+			out = append(out, outURL...)
+		} else {
+			out = append(out, orig[:strings.LastIndex(orig, "/")+1]...)
+			out = append(out, path.Base(outURL)...)
+		}
+		out = append(out, suffix...)
+		last = ref.end
+	}
+
+	return append(out, content[last:]...)
+}
+
+// contentHash returns the hex encoded hash of content used in the names of
+// hashed files.
+func (b *Builder) contentHash(content []byte) string {
+	newHash, ok := hashFuncs[b.config.HashAlgorithm]
+	if !ok {
+		newHash = hashFuncs[DefaultHashAlgorithm]
+	}
+
+	h := newHash()
+	h.Write(content)
+	hashS := hex.EncodeToString(h.Sum(nil))
+
+	length := b.config.HashLength
+	if length <= 0 {
+		length = DefaultHashLength
+	}
+
+	if length < len(hashS) {
+		hashS = hashS[:length]
+	}
+
+	return hashS
+}
+
+// integrity returns the subresource integrity string of content.
+func integrity(content []byte) string {
+	h := sha512.New384()
+	h.Write(content)
+
+	return integrityOf(h)
+}
+
+// integrityOf returns the subresource integrity string of the content
+// written to h, which must be a SHA-384 hash.
+func integrityOf(h hash.Hash) string {
+	return "sha384-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// writeManifest writes ManifestFile to the output dir. It fails if a
+// public asset was written to the same path.
+func (b *Builder) writeManifest(publicAssets map[string]string) error {
+	for key, outURL := range publicAssets {
+		if outURL == "/"+ManifestFile {
+			return fmt.Errorf("%w: %q is written to %q, so build.manifest must be turned off or the file renamed",
+				errManifestConflict, key, ManifestFile)
+		}
+	}
+
+	manifest := make(map[string]manifestEntry)
+	for key, outURL := range publicAssets {
+		manifest[filepath.ToSlash(key)] = manifestEntry{
+			File:      outURL,
+			Integrity: b.integrity[key],
+		}
+	}
+
+	fb, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode manifest: %w", err)
+	}
+
+	outP := filepath.Join(b.config.OutputDir, ManifestFile)
+
+	outF, err := b.mini.CreateRaw(outP)
+	if err != nil {
+		return fmt.Errorf("could not create file %q: %w", outP, err)
+	}
+
+	_, err = outF.Write(fb)
+	if err != nil {
+		outF.Close()
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	err = outF.Close()
+	if err != nil {
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteAssetRefs(t *testing.T) {
+	keys := map[string]bool{
+		"fonts/a.woff2":  true,
+		"css/base.css":   true,
+		"js/util.js":     true,
+		"img/bg.png":     true,
+		"css/styles.css": true,
+	}
+
+	publicAssets := map[string]string{
+		"fonts/a.woff2": "/fonts/a.0cc175b9.woff2",
+		"css/base.css":  "/css/base.92eb5ffe.css",
+		"js/util.js":    "/js/util.4a8a08f0.js",
+		"img/bg.png":    "/img/bg.png",
+	}
+
+	tests := []struct {
+		JS     bool
+		Input  string
+		Expect string
+	}{
+		{
+			Input:  `@font-face{src:url("../fonts/a.woff2?#iefix") format("woff2")}`,
+			Expect: `@font-face{src:url("../fonts/a.0cc175b9.woff2?#iefix") format("woff2")}`,
+		},
+		{
+			Input:  `@import 'base.css'; body{background:url( /img/bg.png )}`,
+			Expect: `@import 'base.92eb5ffe.css'; body{background:url( /img/bg.png )}`,
+		},
+		{
+			Input:  `a{background:url(missing.png)} b{background:url(data:image/png;base64,AA==)}`,
+			Expect: `a{background:url(missing.png)} b{background:url(data:image/png;base64,AA==)}`,
+		},
+		{
+			JS:     true,
+			Input:  "import { x } from \"../js/util.js\";\nimport('../js/util.js');\nimport 'lodash';",
+			Expect: "import { x } from \"../js/util.4a8a08f0.js\";\nimport('../js/util.4a8a08f0.js');\nimport 'lodash';",
+		},
+	}
+
+	for _, tcase := range tests {
+		re := cssRefRegexp
+		if tcase.JS {
+			re = jsRefRegexp
+		}
+
+		refs := findAssetRefs(re, "css/styles.css", []byte(tcase.Input), keys)
+		out := string(rewriteAssetRefs([]byte(tcase.Input), refs, publicAssets, false))
+
+		if out != tcase.Expect {
+			t.Errorf("expected %q but got %q", tcase.Expect, out)
+		}
+	}
+}
+
+func TestSortAssets(t *testing.T) {
+	assets := []*asset{
+		{key: "styles.css", refs: []assetRef{{key: "base.css"}, {key: "font.woff2"}}},
+		{key: "base.css", refs: []assetRef{{key: "font.woff2"}}},
+		{key: "font.woff2"},
+	}
+
+	sorted, err := sortAssets(assets)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	order := make([]string, 0)
+	for _, a := range sorted {
+		order = append(order, a.key)
+	}
+
+	expect := []string{"font.woff2", "base.css", "styles.css"}
+	for i := range expect {
+		if order[i] != expect[i] {
+			t.Fatalf("expected %v but got %v", expect, order)
+		}
+	}
+
+	assets[2].refs = []assetRef{{key: "styles.css"}}
+
+	_, err = sortAssets(assets)
+	if !errors.Is(err, errCircularAssetRef) {
+		t.Errorf("expected circular reference error but got %v", err)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	tests := []struct {
+		Algorithm string
+		Length    int
+		Expect    string
+	}{
+		{Algorithm: "", Length: 0, Expect: "5d41402a"},
+		{Algorithm: "md5", Length: 32, Expect: "5d41402abc4b2a76b9719d911017c592"},
+		{Algorithm: "sha256", Length: 12, Expect: "2cf24dba5fb0"},
+	}
+
+	for _, tcase := range tests {
+		b := &Builder{config: &Config{HashAlgorithm: tcase.Algorithm, HashLength: tcase.Length}}
+
+		if out := b.contentHash([]byte("hello")); out != tcase.Expect {
+			t.Errorf("expected %q but got %q", tcase.Expect, out)
+		}
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	expect := "sha384-WeF0h3dEjGnea4ANejO7+5/xtGPkQ1TDVTvNucZm+pASWjx5+QOXvfX2oT3oKGhP"
+
+	if out := integrity([]byte("hello")); out != expect {
+		t.Errorf("expected %q but got %q", expect, out)
+	}
+}
+
+func TestPublicAssets(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html": "{{ content|safe }}",
+		"pages/index.html":   "",
+		"public/data.json":   `{ "a" : 1 }`,
+		"public/app.js":      "var a = 1 ;",
+	})
+
+	c := newTestSiteConfig()
+	c.NoMinify = false
+	c.HashExts = []string{".js"}
+	c.Manifest = true
+
+	out := NewMemFS()
+	c.OutputFS = out
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fb, err := out.ReadFile(filepath.Join("build", ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest map[string]manifestEntry
+
+	err = json.Unmarshal(fb, &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hashed files are read into memory and files that are not hashed or
+	// scanned for references are streamed, but both are minified and have
+	// the integrity of their output
+	for _, tcase := range []struct {
+		Key    string
+		File   string
+		Expect string
+	}{
+		{Key: "data.json", File: "/data.json", Expect: `{"a":1}`},
+		{Key: "app.js", File: "/app." + b.contentHash([]byte("var a=1")) + ".js", Expect: "var a=1"},
+	} {
+		entry := manifest[tcase.Key]
+		if entry.File != tcase.File {
+			t.Errorf("expected %q to be written to %q but got %q", tcase.Key, tcase.File, entry.File)
+			continue
+		}
+
+		fb, err := out.ReadFile(filepath.Join("build", filepath.FromSlash(tcase.File)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(fb) != tcase.Expect {
+			t.Errorf("expected %q but got %q", tcase.Expect, fb)
+		}
+
+		if expect := integrity(fb); entry.Integrity != expect {
+			t.Errorf("expected integrity %q but got %q", expect, entry.Integrity)
+		}
+	}
+}
+
+func TestManifestConflict(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html":   "{{ content|safe }}",
+		"public/manifest.json": "{}",
+		"pages/.keep":          "",
+	})
+
+	c := newTestSiteConfig()
+	c.Manifest = true
+	c.OutputFS = NewMemFS()
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if !errors.Is(err, errManifestConflict) {
+		t.Errorf("expected %v but got %v", errManifestConflict, err)
+	}
+}
@@ -0,0 +1,1341 @@
+// Package builder builds yagss sites. A site is described by a Config,
+// which is usually read from the config.toml file of the site with
+// ReadConfig, and is built into its output dir with a Builder.
+package builder
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	gohtml "html"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/flosch/pongo2/v4"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/pelletier/go-toml"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting"
+	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+
+	"github.com/AlexanderRichey/yagss/mini"
+)
+
+var (
+	errNotDir                = errors.New("not a directory")
+	errNotSerializable       = errors.New("not serializable")
+	errRequriedFieldNotFound = errors.New("required field not found")
+	errInvalidFormat         = errors.New("invalid file format")
+	errUnknownAsset          = errors.New("unknown asset")
+)
+
+// codeRegexp matches code spans and blocks in rendered markdown. Blocks
+// highlighted by chroma are rendered as <pre> elements without <code>.
+var codeRegexp = regexp.MustCompile(`(?s)<pre[\s>].*?</pre>|<code[\s>].*?</code>`)
+
+const (
+	readWriteExecute = 0777
+	readWrite        = 0666
+)
+
+// Builder builds a site from its pages, posts, public assets, and
+// templates.
+type Builder struct {
+	config    *Config
+	templates *pongo2.TemplateSet
+	markdown  goldmark.Markdown
+	mini      *mini.Creator
+	policy    *bluemonday.Policy
+	images    *imageProcessor
+	out       OutputFS
+	counter   int
+	log       *log.Logger
+	// sourceURLs maps markdown source paths to their output URLs during
+	// a build
+	sourceURLs map[string]string
+	// codeBlocks holds the output of the code block hook while markdown is
+	// rendered
+	codeBlocks map[string]string
+	// generated maps the output paths of generated pages to the markdown
+	// pages that generate them during a build
+	generated map[string]string
+	// integrity maps the keys of public assets to their subresource
+	// integrity strings during a build
+	integrity map[string]string
+	// transformers transform files in the public dir before they are
+	// minified and hashed
+	transformers []Transformer
+	// plugins hook into the build
+	plugins []Plugin
+	// posts and assets hold the posts and public assets of the current
+	// build for plugins
+	posts  []*Post
+	assets map[string]string
+	// changed holds the files whose change caused the current build
+	changed []string
+	// data holds the contents of the data files of the current build
+	data map[string]interface{}
+	// filters are the pongo2 filters of the Builder, which are called by
+	// the filters registered with pongo2 when the Builder executes a
+	// template
+	filters map[string]pongo2.FilterFunction
+	// tplCache caches compiled templates across builds
+	tplCache *templateCache
+	// defaults maps directories to their default front matter during a
+	// build
+	defaults map[string]map[string]string
+	// problems holds the problems found during a strict build, and current
+	// is the file being processed, which problems are reported for
+	problems Problems
+	current  string
+}
+
+// Config configures a Builder.
+type Config struct {
+	SiteURL             string
+	SiteTitle           string
+	SiteDescription     string
+	TemplatesDir        string
+	PagesDir            string
+	PostsDir            string
+	PublicDir           string
+	OutputDir           string
+	DataDir             string
+	DefaultPostTemplate string
+	DefaultPageTemplate string
+	ChromaTheme         string
+	ChromaLineNumbers   bool
+	ChromaWithClasses   bool
+	PostsIndex          string
+	PostsPerPage        int
+	RSS                 bool
+	HashExts            []string
+	// MarkdownSafe omits raw HTML in markdown.
+	MarkdownSafe       bool
+	Sanitize           bool
+	SanitizeElements   []string
+	SanitizeAttributes []string
+	// NoMarkdownTemplating keeps template directives in markdown files
+	// from being evaluated.
+	NoMarkdownTemplating bool
+	BrokenLinks          string
+	Strict               bool
+	RewriteJS            bool
+	HashAlgorithm        string
+	HashLength           int
+	Manifest             bool
+	Bundles              []Bundle
+	Transforms           []TransformConfig
+	NoMinify             bool
+	MinifyDisabledTypes  []string
+	MinifyHTML           *mini.HTMLOptions
+	MinifyExtensions     map[string]string
+	Gzip                 bool
+	GzipMinSize          int
+	ImageWidths          []int
+	ImageQuality         int
+	ImageCacheDir        string
+	// NoImageAttributes keeps dimensions and loading attributes from being
+	// added to images in markdown.
+	NoImageAttributes bool
+	// PreBuildCommand and PostBuildCommand are shell commands that run
+	// before and after each build.
+	PreBuildCommand  string
+	PostBuildCommand string
+	// TransformCommands are shell commands that transform files in the
+	// public dir after the built-in transformers.
+	TransformCommands []TransformCommand
+	// OutputFS is the filesystem that output is written to. If nil, output
+	// is written to disk.
+	OutputFS OutputFS
+}
+
+// Post is a blog post. Posts are passed to templates, which can use all of
+// its exported fields.
+type Post struct {
+	Title        string
+	Description  string
+	Date         time.Time
+	Content      string
+	Path         string
+	URL          string
+	localOutPath string
+	localSrcPath string
+	frontMatter  map[string]string
+}
+
+// FrontMatter returns the front matter of the post.
+func (p *Post) FrontMatter() map[string]string {
+	return p.frontMatter
+}
+
+// minifyOptions returns the options of the mini.Creator used by the
+// Builder, which minifies and compresses output files.
+func (c *Config) minifyOptions() []mini.Option {
+	opts := []mini.Option{mini.WithoutTypes(c.MinifyDisabledTypes...)}
+
+	if c.NoMinify {
+		opts = append(opts, mini.Disabled())
+	}
+
+	if c.MinifyHTML != nil {
+		opts = append(opts, mini.WithHTMLOptions(*c.MinifyHTML))
+	}
+
+	for ext, mime := range c.MinifyExtensions {
+		opts = append(opts, mini.WithExtension(ext, mime))
+	}
+
+	if c.Gzip {
+		opts = append(opts, mini.WithGzip(c.GzipMinSize))
+	}
+
+	return opts
+}
+
+// New creates a new Builder instance. It initializes dependencies needed
+// to do the work of building. If l is nil, a default logger is used.
+// Plugins hook into builds in the order they are given.
+func New(c *Config, l *log.Logger, plugins ...Plugin) (*Builder, error) {
+	builder := &Builder{config: c, plugins: plugins}
+
+	// Init logger
+	if l != nil {
+		builder.log = l
+	} else {
+		builder.log = log.New(os.Stderr, "", 0)
+	}
+
+	// Init pongo2
+	loader, err := pongo2.NewLocalFileSystemLoader(c.TemplatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not load templates: %w", err)
+	}
+
+	builder.templates, err = pongo2.NewSet("templates", loader), nil
+	if err != nil {
+		return nil, fmt.Errorf("could not load templates: %w", err)
+	}
+
+	builder.tplCache = newTemplateCache()
+
+	// Init asset transformers
+	for _, tc := range c.Transforms {
+		t, err := newTransformer(tc)
+		if err != nil {
+			return nil, err
+		}
+
+		builder.AddTransformer(t)
+	}
+
+	for _, tc := range c.TransformCommands {
+		builder.AddTransformer(&commandTransformer{
+			globMatcher: globMatcher(tc.Pattern),
+			command:     tc.Command,
+			env:         builder.hookEnv,
+		})
+	}
+
+	// Init image processing
+	builder.images = newImageProcessor(builder)
+
+	// Init template filters and tags
+	err = builder.initTemplateFuncs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Init goldmark. Raw HTML in markdown is passed through unless
+	// c.MarkdownSafe is true, in which case goldmark omits it.
+	var rendererOpts []renderer.Option
+	if !c.MarkdownSafe {
+		rendererOpts = append(rendererOpts, html.WithUnsafe())
+	}
+
+	highlightOpts := []highlighting.Option{
+		highlighting.WithStyle(c.ChromaTheme),
+		highlighting.WithFormatOptions(
+			chromahtml.WithLineNumbers(c.ChromaLineNumbers),
+			chromahtml.WithClasses(c.ChromaWithClasses)),
+	}
+
+	// Relative links to markdown files are resolved to their outputs and
+	// local images are resolved against the public assets
+	parserOpts := []parser.Option{
+		parser.WithASTTransformers(
+			util.Prioritized(&linkResolver{b: builder}, 100),
+			util.Prioritized(&imageResolver{b: builder}, 100)),
+	}
+
+	// Templates in the hooks dir override how some elements are rendered
+	if hooks := findRenderHooks(c.TemplatesDir); len(hooks) > 0 {
+		rendererOpts = append(rendererOpts, renderer.WithNodeRenderers(
+			util.Prioritized(newRenderHooks(builder, hooks,
+				highlighting.NewHTMLRenderer(highlightOpts...)), 100)))
+
+		if hooks[hookHeading] {
+			parserOpts = append(parserOpts, parser.WithAutoHeadingID())
+		}
+	}
+
+	builder.markdown = goldmark.New(
+		goldmark.WithExtensions(meta.Meta, highlighting.NewHighlighting(highlightOpts...)),
+		goldmark.WithParserOptions(parserOpts...),
+		goldmark.WithRendererOptions(rendererOpts...))
+
+	// Init sanitizer
+	if c.Sanitize {
+		builder.policy = newPolicy(c.SanitizeElements, c.SanitizeAttributes)
+	}
+
+	// Init mini
+	builder.out = c.OutputFS
+	if builder.out == nil {
+		builder.out = DiskFS{}
+	}
+
+	builder.mini = mini.New(append(c.minifyOptions(), mini.WithFS(builder.out))...)
+
+	return builder, nil
+}
+
+// Build builds the site into the output dir. The output dir is removed
+// before the site is built.
+func (b *Builder) Build() error {
+	return b.BuildChanged(nil)
+}
+
+// BuildChanged builds the site like Build after the files at the paths in
+// changed have changed. The paths are passed to hook commands.
+func (b *Builder) BuildChanged(changed []string) error {
+	t0 := time.Now()
+
+	b.changed = changed
+
+	// Verify that pages, public, templates, and data dirs exist
+	dirs := []string{
+		b.config.PagesDir,
+		b.config.PublicDir,
+		b.config.TemplatesDir,
+	}
+	if b.config.DataDir != "" {
+		dirs = append(dirs, b.config.DataDir)
+	}
+
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("could not resolve directory %q: %w", dir, err)
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("%w: %q", errNotDir, dir)
+		}
+	}
+
+	// Create the output dir if it exists
+	err := b.out.RemoveAll(b.config.OutputDir)
+	if err != nil {
+		return fmt.Errorf("could not clean output dir: %w", err)
+	}
+
+	// Create the output dir
+	err = b.out.MkdirAll(b.config.OutputDir, os.FileMode(readWriteExecute))
+	if err != nil {
+		return fmt.Errorf("could not create output dir: %w", err)
+	}
+
+	b.log.Printf("Starting build...\n")
+
+	b.images.reset()
+	b.tplCache.reset()
+	b.integrity = make(map[string]string)
+	b.generated = make(map[string]string)
+	b.defaults = make(map[string]map[string]string)
+	b.posts = nil
+	b.assets = nil
+	b.problems = nil
+	b.current = ""
+
+	err = b.runHook("preBuild", b.config.PreBuildCommand)
+	if err != nil {
+		return err
+	}
+
+	// Data is loaded after the preBuild hook, which may generate it
+	b.data = make(map[string]interface{})
+	if b.config.DataDir != "" {
+		b.data, err = loadData(b.config.DataDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.templates.Globals["data"] = b.data
+
+	err = b.runBeforeBuild()
+	if err != nil {
+		return err
+	}
+
+	publicAssets, err := b.handlePublic()
+	if err != nil {
+		return err
+	}
+
+	b.assets = publicAssets
+
+	err = b.handleBundles(publicAssets)
+	if err != nil {
+		return err
+	}
+
+	if b.config.Manifest {
+		err = b.writeManifest(publicAssets)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.sourceURLs, err = b.gatherSourceURLs()
+	if err != nil {
+		return err
+	}
+
+	postList, err := b.handlePosts(publicAssets)
+	if err != nil {
+		return err
+	}
+
+	b.posts = postList
+
+	err = b.handlePages(publicAssets, postList)
+	if err != nil {
+		return err
+	}
+
+	err = b.handleRSS(postList)
+	if err != nil {
+		return err
+	}
+
+	// Strict builds fail after everything is built, so that all problems
+	// are reported
+	if len(b.problems) > 0 {
+		return b.problems
+	}
+
+	err = b.runAfterBuild()
+	if err != nil {
+		return err
+	}
+
+	err = b.runHook("postBuild", b.config.PostBuildCommand)
+	if err != nil {
+		return err
+	}
+
+	b.tplCache.sweep()
+
+	b.log.Printf("Processed %d files in %s\n", b.counter, time.Since(t0))
+
+	b.counter = 0
+
+	return nil
+}
+
+func (b *Builder) handlePublic() (map[string]string, error) {
+	publicAssets := make(map[string]string)
+
+	assets, err := b.gatherAssets()
+	if err != nil {
+		return nil, err
+	}
+
+	// Process assets in dependency order so that references to other
+	// assets can be rewritten to their hashed outputs, and so that a change
+	// to a referenced asset also changes the hash of the referencing asset
+	assets, err = sortAssets(assets)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range assets {
+		err = b.writeAsset(a, publicAssets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return publicAssets, nil
+}
+
+// writeAsset writes a to the output dir, adds its output URL to
+// publicAssets, and records its integrity.
+func (b *Builder) writeAsset(a *asset, publicAssets map[string]string) error {
+	b.counter++
+	b.log.Printf("==> Processing %q", a.path)
+
+	// Determine the output filepath
+	outP := filepath.Join(b.config.OutputDir, a.key)
+
+	// Files whose content is not needed up front are copied without
+	// reading them into memory
+	if a.content == nil && !b.isHashed(outP) {
+		return b.streamAsset(a, outP, publicAssets)
+	}
+
+	content := a.content
+	if content == nil {
+		var err error
+		content, err = ioutil.ReadFile(a.path)
+		if err != nil {
+			return fmt.Errorf("could not read file %q: %w", a.path, err)
+		}
+	}
+
+	if len(a.refs) > 0 {
+		content = rewriteAssetRefs(content, a.refs, publicAssets, false)
+	}
+
+	return b.emitAsset(a.key, outP, content, publicAssets)
+}
+
+// streamAsset minifies the file of a while copying it to outP and records
+// its output URL and integrity like emitAsset.
+func (b *Builder) streamAsset(a *asset, outP string, publicAssets map[string]string) error {
+	inF, err := os.Open(a.path)
+	if err != nil {
+		return fmt.Errorf("could not read file %q: %w", a.path, err)
+	}
+	defer inF.Close()
+
+	outF, err := b.mini.CreateRaw(outP)
+	if err != nil {
+		return fmt.Errorf("could not create file %q: %w", outP, err)
+	}
+
+	// The integrity is computed over the minified content as it is written
+	h := sha512.New384()
+	w := b.mini.Wrap(io.MultiWriter(outF, h), outP)
+
+	_, err = io.Copy(w, inF)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		outF.Close()
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	err = outF.Close()
+	if err != nil {
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	publicAssets[a.key] = b.outURLPath(outP)
+	b.integrity[a.key] = integrityOf(h)
+
+	return nil
+}
+
+// isHashed reports whether the hash of the content of the file at path is
+// added to its name, which is the case if its extension is one in HashExts.
+func (b *Builder) isHashed(path string) bool {
+	ext := filepath.Ext(path)
+	for _, cmp := range b.config.HashExts {
+		if ext == cmp {
+			return true
+		}
+	}
+
+	return false
+}
+
+// emitAsset minifies content and writes it to outP, adding a hash to the
+// file name if its extension is one in HashExts. The output URL is added
+// to publicAssets and the integrity is recorded under key.
+func (b *Builder) emitAsset(key, outP string, content []byte, publicAssets map[string]string) error {
+	// Hashes and integrities are computed over the final content, so the
+	// content is minified before it is written
+	content, err := b.mini.Bytes(outP, content)
+	if err != nil {
+		return err
+	}
+
+	// If the extension matches one in $b.config.HashExts, then add the
+	// hash of the content to the filename
+	if b.isHashed(outP) {
+		fsplit := strings.Split(filepath.Base(outP), ".")
+		fsplit = append(fsplit[:len(fsplit)-1], b.contentHash(content), fsplit[len(fsplit)-1])
+		outP = filepath.Join(filepath.Dir(outP), strings.Join(fsplit, "."))
+	}
+
+	// Finally create the output file and write content to it. The content
+	// is already minified, so it is written as is.
+	outF, err := b.mini.CreateRaw(outP)
+	if err != nil {
+		return fmt.Errorf("could not create file %q: %w", outP, err)
+	}
+
+	_, err = outF.Write(content)
+	if err != nil {
+		outF.Close()
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	err = outF.Close()
+	if err != nil {
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	publicAssets[key] = b.outURLPath(outP)
+	b.integrity[key] = integrity(content)
+
+	return nil
+}
+
+func (b *Builder) handlePosts(publicAssets map[string]string) ([]*Post, error) {
+	postList, err := b.gatherPosts(publicAssets)
+	if err != nil {
+		return postList, fmt.Errorf("error gathering posts: %w", err)
+	}
+
+	// Create the output dir
+	if len(postList) > 0 {
+		err := b.out.MkdirAll(
+			filepath.Join(b.config.OutputDir, filepath.Base(b.config.PostsDir)),
+			os.FileMode(readWriteExecute))
+		if err != nil {
+			return nil, fmt.Errorf("could not create posts dir: %w", err)
+		}
+	}
+
+	for i, post := range postList {
+		b.counter++
+		b.current = post.localSrcPath
+		b.log.Printf("==> Processing %q", post.localSrcPath)
+
+		var (
+			prevPost *Post
+			nextPost *Post
+		)
+		if prevIdx := i + 1; prevIdx < len(postList) {
+			prevPost = postList[prevIdx]
+		}
+		if nextIdx := i - 1; nextIdx >= 0 {
+			nextPost = postList[nextIdx]
+		}
+
+		tpl, err := b.resolveTplFromFM(b.config.DefaultPostTemplate, post.frontMatter)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving post template: %w", err)
+		}
+
+		err = b.writeTpl(tpl, post.localOutPath, pongo2.Context{
+			"pageTitle":       fmt.Sprintf("%s | %s", b.config.SiteTitle, post.Title),
+			"pageDescription": post.Description,
+			"siteURL":         b.config.SiteURL,
+			"assets":          publicAssets,
+			"title":           post.Title,
+			"date":            post.Date,
+			"content":         post.Content,
+			"path":            post.Path,
+			"url":             post.URL,
+			"prevPost":        prevPost,
+			"nextPost":        nextPost,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error writing post: %w", err)
+		}
+	}
+
+	return postList, nil
+}
+
+func (b *Builder) handlePages(publicAssets map[string]string, postList []*Post) error {
+	return filepath.Walk(b.config.PagesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Create a corresponding directory in the $b.config.OutputDir
+		if info.IsDir() {
+			// The output dir itself already exists
+			if path == b.config.PagesDir {
+				return nil
+			}
+
+			return b.mkOutDir(b.config.PagesDir, path)
+		}
+
+		// Defaults files only set front matter
+		if isDefaultsFile(path) {
+			return nil
+		}
+
+		b.counter++
+		b.current = path
+		b.log.Printf("==> Processing %q", path)
+
+		switch filepath.Ext(path) {
+		case ".html":
+			if filepath.Base(b.config.PostsIndex) == info.Name() {
+				err = b.handlePostsIdx(path, postList, publicAssets)
+			} else {
+				err = b.handleHTMLPage(path, publicAssets)
+			}
+		case ".md":
+			err = b.handleMDPage(path, publicAssets)
+		default:
+			err = fmt.Errorf("%w: %q", errInvalidFormat, path)
+		}
+		if err != nil {
+			return fmt.Errorf("error processing file %q: %w", path, err)
+		}
+
+		return nil
+	})
+}
+
+func (b *Builder) handleRSS(postList []*Post) error {
+	if !b.config.RSS || len(postList) == 0 {
+		return nil
+	}
+
+	n := len(postList)
+	if n > b.config.PostsPerPage {
+		n = b.config.PostsPerPage
+	}
+
+	// Copy the posts so that their content can be replaced with a summary
+	// without changing the posts seen by plugins
+	posts := make([]*Post, n)
+	for i := range posts {
+		post := *postList[i]
+		posts[i] = &post
+	}
+
+	b.counter++
+	b.current = "rss.xml"
+	b.log.Printf("==> Processing %q", "rss.xml")
+
+	tpl, err := b.fromString(rssT)
+	if err != nil {
+		return fmt.Errorf("could not compile rss template: %w", err)
+	}
+
+	p := bluemonday.StrictPolicy()
+
+	for i := range posts {
+		if posts[i].Description != b.config.SiteDescription {
+			posts[i].Content = posts[i].Description
+		} else if len(posts[i].Content) > 0 {
+			// Take the first paragraph
+			clean := strings.TrimSpace(p.Sanitize(posts[i].Content))
+			split := strings.Split(clean, "\n")
+			if len(split) > 0 {
+				posts[i].Content = gohtml.UnescapeString(split[0])
+			} else {
+				posts[i].Content = clean
+			}
+		} else {
+			posts[i].Content = "Nothing here."
+		}
+	}
+
+	outP := filepath.Join(b.config.OutputDir, "rss.xml")
+
+	err = b.writeTpl(tpl, outP, pongo2.Context{
+		"title":       b.config.SiteTitle,
+		"url":         b.config.SiteURL,
+		"description": b.config.SiteDescription,
+		"date":        postList[0].Date,
+		"posts":       posts,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing rss %q: %w", outP, err)
+	}
+
+	return nil
+}
+
+func (b *Builder) handleMDPage(path string, publicAssets map[string]string) error {
+	outP := b.mdPageOutPath(path)
+
+	doc, err := b.parseMD(path, publicAssets)
+	if err != nil {
+		return fmt.Errorf("error rendering markdown: %w", err)
+	}
+
+	// Pages with a "generate" directive are templates for the items of a
+	// data file
+	if _, ok := doc.frontMatter["generate"]; ok {
+		return b.generatePages(path, doc, publicAssets)
+	}
+
+	mdS, err := doc.execute(pongo2.Context{"assets": publicAssets})
+	if err != nil {
+		return fmt.Errorf("error rendering markdown: %w", err)
+	}
+
+	frontMatter := doc.frontMatter
+
+	tpl, err := b.resolveTplFromFM(b.config.DefaultPageTemplate, frontMatter)
+	if err != nil {
+		return fmt.Errorf("could not get page template for %q: %w", path, err)
+	}
+
+	pageTitle, title, desc := b.getPageMeta(frontMatter)
+
+	err = b.writeTpl(tpl, outP, pongo2.Context{
+		"pageTitle":       pageTitle,
+		"pageDescription": desc,
+		"siteURL":         b.config.SiteURL,
+		"assets":          publicAssets,
+		"title":           title,
+		"content":         mdS,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing markdown page %q: %w", outP, err)
+	}
+
+	return nil
+}
+
+func (b *Builder) handleHTMLPage(path string, publicAssets map[string]string) error {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read file %q: %w", path, err)
+	}
+
+	tpl, err := b.fromBytes(fb)
+	if err != nil {
+		return fmt.Errorf("could not compile page %q: %w", path, err)
+	}
+
+	// Determine the output path
+	outP := filepath.Join(b.config.OutputDir, relPath(b.config.PagesDir, path))
+
+	err = b.writeTpl(tpl, outP, pongo2.Context{
+		"pageTitle":       b.config.SiteTitle,
+		"pageDescription": b.config.SiteDescription,
+		"siteURL":         b.config.SiteURL,
+		"assets":          publicAssets,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing html page %q: %w", outP, err)
+	}
+
+	return nil
+}
+
+func (b *Builder) handlePostsIdx(path string, postList []*Post, publicAssets map[string]string) error {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read file %q: %w", path, err)
+	}
+
+	tpl, err := b.fromBytes(fb)
+	if err != nil {
+		return fmt.Errorf("could not compile template %q: %w", path, err)
+	}
+
+	plist := getPlist(b.config.PostsPerPage, postList)
+
+	for i, posts := range plist {
+		// Determine next and prev urls
+		next := ""
+		prev := ""
+
+		if len(plist) > i+1 {
+			next = fmt.Sprintf("/page%d", i+2)
+		}
+
+		if i > 0 {
+			if i-1 == 0 {
+				prev = "/" + filepath.ToSlash(relPath(b.config.PagesDir, path))
+			} else {
+				prev = fmt.Sprintf("/page%d", i)
+			}
+		}
+
+		// Determine the output path
+		outP := filepath.Join(b.config.OutputDir, relPath(b.config.PagesDir, path))
+
+		// if i > 0, then we're on a new page that will need
+		// its own output dir.
+		if i > 0 {
+			pageS := fmt.Sprintf("page%d", i+1)
+
+			dirP := filepath.Join(b.config.OutputDir, pageS)
+
+			err := b.out.MkdirAll(dirP, os.FileMode(readWriteExecute))
+			if err != nil {
+				return fmt.Errorf("could not create directory %q: %w", dirP, err)
+			}
+
+			// adjust the output path
+			outP = filepath.Join(dirP, "index.html")
+		}
+
+		err = b.writeTpl(tpl, outP, pongo2.Context{
+			"pageTitle":       b.config.SiteTitle,
+			"pageDescription": b.config.SiteDescription,
+			"siteURL":         b.config.SiteURL,
+			"assets":          publicAssets,
+			"posts":           posts,
+			"next":            next,
+			"prev":            prev,
+		})
+		if err != nil {
+			return fmt.Errorf("error writing index page %q: %w", outP, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *Builder) gatherPosts(publicAssets map[string]string) ([]*Post, error) {
+	postList := make([]*Post, 0)
+
+	// If PagesDir isn't defined, then don't bother with posts.
+	if b.config.PagesDir == "" {
+		return postList, nil
+	}
+
+	err := filepath.Walk(b.config.PostsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == b.config.PostsDir && os.IsNotExist(err) {
+				// PostsDir does not exist, so skip posts.
+				return nil
+			}
+
+			return err
+		}
+
+		if info.IsDir() || isDefaultsFile(path) {
+			return nil
+		}
+
+		outP := b.postOutPath(path)
+		postPath := b.outURLPath(outP)
+
+		b.current = path
+
+		mdS, frontMatter, err := b.renderMD(path, publicAssets)
+		if err != nil {
+			return fmt.Errorf("could not process post: %w", err)
+		}
+
+		title, desc, pubDate, err := b.getPostMeta(frontMatter)
+		if err != nil {
+			return fmt.Errorf("could not get post metadata: %w", err)
+		}
+
+		post := &Post{
+			Title:        title,
+			Date:         pubDate,
+			Description:  desc,
+			Content:      mdS,
+			Path:         postPath,
+			URL:          fmt.Sprintf("%s%s", b.config.SiteURL, postPath),
+			localOutPath: outP,
+			localSrcPath: path,
+			frontMatter:  frontMatter,
+		}
+
+		err = b.runPostParsed(post)
+		if err != nil {
+			return err
+		}
+
+		postList = append(postList, post)
+
+		return nil
+	})
+	if err != nil {
+		return postList, fmt.Errorf("error walking posts dir: %w", err)
+	}
+
+	sort.SliceStable(postList, func(i, j int) bool {
+		return postList[i].Date.After(postList[j].Date)
+	})
+
+	return postList, nil
+}
+
+func (b *Builder) renderMD(path string, publicAssets map[string]string) (string, map[string]string, error) {
+	doc, err := b.parseMD(path, publicAssets)
+	if err != nil {
+		return "", nil, err
+	}
+
+	mdS, err := doc.execute(pongo2.Context{"assets": publicAssets})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return mdS, doc.frontMatter, nil
+}
+
+// mdDoc is a markdown file that is converted to HTML but whose template
+// directives are not yet evaluated.
+type mdDoc struct {
+	html        string
+	frontMatter map[string]string
+	// tpl is the intermediate template of html, or nil if templating is
+	// off for the file
+	tpl        *pongo2.Template
+	b          *Builder
+	shortcodes map[string]string
+}
+
+// parseMD converts the markdown file at path to HTML and compiles the
+// template directives in it.
+func (b *Builder) parseMD(path string, publicAssets map[string]string) (*mdDoc, error) {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read markdown file %q: %w", path, err)
+	}
+
+	// Replace shortcodes with placeholders. They are rendered separately
+	// and substituted after template directives are evaluated. Front matter
+	// is left as it is.
+	fm, body := splitFrontMatter(fb)
+
+	body, shortcodes, err := b.expandShortcodes(body, publicAssets)
+	if err != nil {
+		return nil, fmt.Errorf("could not render shortcodes in %q: %w", path, err)
+	}
+
+	// Get front-matter. It is read before rendering so that the templating
+	// directive is known when preparing the body.
+	items, err := parseFrontMatter(fm)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse front-matter on %q: %w", path, err)
+	}
+
+	frontMatter, err := msi2mss(items)
+	if err != nil {
+		return nil, fmt.Errorf("could not process front-matter on %q: %w", path, err)
+	}
+
+	// Fill in the defaults of the directories of the file
+	frontMatter, err = b.withDefaults(path, frontMatter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Template directives inside markdown files are evaluated unless
+	// disabled site-wide or with a "templating" front-matter directive
+	templating := !b.config.NoMarkdownTemplating
+	if dat, ok := frontMatter["templating"]; ok {
+		templating, err = strconv.ParseBool(dat)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse templating directive on %q: %w", path, err)
+		}
+	}
+
+	// Images pointing at template directives are only resolved when the
+	// directives are evaluated
+	if templating && !b.config.NoImageAttributes {
+		body = resolveAssetImages(body, publicAssets)
+	}
+
+	fb = append(fm[:len(fm):len(fm)], body...)
+
+	buf := new(bytes.Buffer)
+
+	// Render markdown
+	ctx := parser.NewContext()
+	ctx.Set(srcPathKey, filepath.Clean(path))
+	ctx.Set(assetsKey, publicAssets)
+
+	err = b.markdown.Convert(fb, buf, parser.WithContext(ctx))
+
+	// Code blocks rendered by a hook are substituted like shortcodes
+	for key, s := range b.takeCodeBlocks() {
+		shortcodes[key] = s
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not render markdown in %q: %w", path, err)
+	}
+
+	if err, ok := ctx.Get(linkErrKey).(error); ok {
+		return nil, fmt.Errorf("could not resolve links in %q: %w", path, err)
+	}
+
+	doc := &mdDoc{
+		html:        buf.String(),
+		frontMatter: frontMatter,
+		b:           b,
+		shortcodes:  shortcodes,
+	}
+
+	if templating {
+		// Compile an intermediate template in case there are template directives
+		// inside the markdown file
+		doc.tpl, err = b.fromString(protectCode(doc.html))
+		if err != nil {
+			return nil, fmt.Errorf("could not compile intermediate template: %w", err)
+		}
+	}
+
+	return doc, nil
+}
+
+// execute evaluates the template directives of the document with p2ctx and
+// returns the final HTML.
+func (d *mdDoc) execute(p2ctx pongo2.Context) (string, error) {
+	mdS := d.html
+
+	if d.tpl != nil {
+		var err error
+
+		mdS, err = d.b.execute(d.tpl, p2ctx)
+		if err != nil {
+			return "", fmt.Errorf("could not render intermediate template: %w", err)
+		}
+	}
+
+	// Shortcodes are sanitized along with the rest of the document, since
+	// their templates can output content from the markdown file
+	mdS = replaceShortcodes(mdS, d.shortcodes)
+
+	if d.b.policy != nil {
+		mdS = d.b.policy.Sanitize(mdS)
+	}
+
+	return mdS, nil
+}
+
+func (b *Builder) resolveTplFromFM(defaultTplP string, frontMatter map[string]string) (*pongo2.Template, error) {
+	// The default template can be overridden with a front-matter
+	// directive
+	var tplP string
+	if dat, ok := frontMatter["template"]; ok {
+		tplP = dat
+	} else {
+		tplP = defaultTplP
+	}
+
+	// Get the base template
+	bTpl, err := b.fromFile(tplP)
+	if err != nil {
+		return nil, fmt.Errorf("could not get template %q: %w", tplP, err)
+	}
+
+	return bTpl, err
+}
+
+func (b *Builder) writeTpl(tpl *pongo2.Template, outP string, p2ctx pongo2.Context) error {
+	// We render the base template first so that plugins can modify the
+	// output before it is written
+	content, err := b.execute(tpl, p2ctx)
+	if err != nil {
+		return fmt.Errorf("could not render template to %q: %w", outP, err)
+	}
+
+	page := &Page{Path: outP, URL: b.outURLPath(outP), Content: []byte(content)}
+
+	err = b.runPageRendered(page)
+	if err != nil {
+		return err
+	}
+
+	// Finally create the output file and write content to it
+	outF, err := b.mini.Create(outP)
+	if err != nil {
+		return fmt.Errorf("could not create file %q: %w", outP, err)
+	}
+
+	_, err = outF.Write(page.Content)
+	if err != nil {
+		outF.Close()
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	err = outF.Close()
+	if err != nil {
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	return nil
+}
+
+// mdPageOutPath returns the output path of the markdown page at path.
+func (b *Builder) mdPageOutPath(path string) string {
+	rel := relPath(b.config.PagesDir, path)
+
+	return filepath.Join(b.config.OutputDir, strings.TrimSuffix(rel, filepath.Ext(rel))+".html")
+}
+
+// postOutPath returns the output path of the post at path. Posts are
+// written to a dir named like the posts dir.
+func (b *Builder) postOutPath(path string) string {
+	rel := relPath(b.config.PostsDir, path)
+
+	return filepath.Join(b.config.OutputDir, filepath.Base(b.config.PostsDir),
+		strings.TrimSuffix(rel, filepath.Ext(rel))+".html")
+}
+
+// outURLPath returns the relative URL of the output file at outP.
+func (b *Builder) outURLPath(outP string) string {
+	return "/" + filepath.ToSlash(relPath(b.config.OutputDir, outP))
+}
+
+// relPath returns path relative to dir, which contains it.
+func relPath(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return path
+	}
+
+	return rel
+}
+
+// mkOutDir creates the dir in the output dir that corresponds to path,
+// which is in the source dir dir.
+func (b *Builder) mkOutDir(dir, path string) error {
+	dirP := filepath.Join(b.config.OutputDir, relPath(dir, path))
+
+	err := b.out.MkdirAll(dirP, os.FileMode(readWriteExecute))
+	if err != nil {
+		return fmt.Errorf("could not create directory %q: %w", dirP, err)
+	}
+
+	return nil
+}
+
+func (b *Builder) getPostMeta(frontMatter map[string]string) (title, desc string, date time.Time, err error) {
+	// Check for required fields
+	for _, key := range []string{"title", "date"} {
+		if _, ok := frontMatter[key]; !ok {
+			return "", "", date, fmt.Errorf("%w: %q", errRequriedFieldNotFound, key)
+		}
+	}
+
+	pubDate, err := time.Parse("2006-01-02", frontMatter["date"])
+	if err != nil {
+		return "", "", date, fmt.Errorf("could not parse date %q: %w", frontMatter["date"], err)
+	}
+
+	// Optional description metadata
+	if _, ok := frontMatter["description"]; !ok {
+		frontMatter["description"] = b.config.SiteDescription
+	}
+
+	return frontMatter["title"], frontMatter["description"], pubDate, nil
+}
+
+func (b *Builder) getPageMeta(frontMatter map[string]string) (pageTitle, title, desc string) {
+	desc = b.config.SiteDescription
+	if dat, ok := frontMatter["description"]; ok {
+		desc = dat
+	}
+
+	title = ""
+	pageTitle = b.config.SiteTitle
+	if dat, ok := frontMatter["title"]; ok {
+		title = dat
+		pageTitle = fmt.Sprintf("%s | %s", b.config.SiteTitle, dat)
+	}
+
+	return pageTitle, title, desc
+}
+
+func msi2mss(msi map[string]interface{}) (map[string]string, error) {
+	data := make(map[string]string)
+
+	for key, val := range msi {
+		s, ok := scalarString(val)
+		if !ok {
+			return nil, fmt.Errorf("%w: key %q must be a string, number, boolean, date, or list of them",
+				errNotSerializable, key)
+		}
+
+		data[key] = s
+	}
+
+	return data, nil
+}
+
+// scalarString returns the string, number, boolean, or date v as a string.
+// Dates are formatted like 2006-01-02, or like RFC 3339 if they have a
+// time. Lists of them, such as tags, are joined by commas.
+func scalarString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), true
+	case toml.LocalDate, toml.LocalDateTime, toml.LocalTime:
+		return fmt.Sprint(v), true
+	case time.Time:
+		return v.Format(time.RFC3339), true
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return "", false
+			}
+
+			s, ok := scalarString(item)
+			if !ok {
+				return "", false
+			}
+
+			items[i] = s
+		}
+
+		return strings.Join(items, ","), true
+	default:
+		return "", false
+	}
+}
+
+// protectCode escapes the opening braces inside code spans and blocks so
+// that their content is not evaluated when s is compiled as a template.
+func protectCode(s string) string {
+	return codeRegexp.ReplaceAllStringFunc(s, func(code string) string {
+		return strings.ReplaceAll(code, "{", "&#123;")
+	})
+}
+
+func getPlist(psize int, postList []*Post) [][]*Post {
+	postPgs := make([][]*Post, 0)
+	idx := -1
+
+	if psize <= 0 {
+		return postPgs
+	}
+
+	for i, p := range postList {
+		if i%psize == 0 {
+			ns := make([]*Post, 0)
+			postPgs = append(postPgs, ns)
+			idx++
+		}
+
+		postPgs[idx] = append(postPgs[idx], p)
+	}
+
+	return postPgs
+}
@@ -0,0 +1,147 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBuilding pretty much just makes sure nothing is really broken.
+// But it doesn't make sure things are really working.
+func TestBuilding(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(wd) != "builder" {
+		t.Fatal("running tests in wrong dir")
+	}
+
+	err = os.Chdir("../example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		t.Log("removing test-build dir")
+		err := os.RemoveAll("test-build")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chdir(wd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	c, err := ReadConfig(ConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.OutputDir = "test-build"
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProtectCode(t *testing.T) {
+	tests := []struct {
+		In  string
+		Out string
+	}{
+		{
+			In:  `<p>{{ title }}</p>`,
+			Out: `<p>{{ title }}</p>`,
+		},
+		{
+			In:  `<p><code>{{ title }}</code> {{ title }}</p>`,
+			Out: `<p><code>&#123;&#123; title }}</code> {{ title }}</p>`,
+		},
+		{
+			In:  "<pre style=\"color:#000\"><span>{% if x %}</span>\n</pre>",
+			Out: "<pre style=\"color:#000\"><span>&#123;% if x %}</span>\n</pre>",
+		},
+	}
+
+	for _, tcase := range tests {
+		if out := protectCode(tcase.In); out != tcase.Out {
+			t.Errorf("expected %q but got %q", tcase.Out, out)
+		}
+	}
+}
+
+func TestMarkdownTemplating(t *testing.T) {
+	tests := []struct {
+		Name         string
+		FrontMatter  string
+		NoTemplating bool
+		Expect       string
+	}{
+		{
+			Name:   "evaluated",
+			Expect: "<p>Hello WORLD</p>",
+		},
+		{
+			Name:         "off site-wide",
+			NoTemplating: true,
+			Expect:       "<p>Hello {{ 'world'|upper }}</p>",
+		},
+		{
+			Name:        "off in front matter",
+			FrontMatter: "---\ntemplating: false\n---\n",
+			Expect:      "<p>Hello {{ 'world'|upper }}</p>",
+		},
+		{
+			Name:         "on in front matter",
+			FrontMatter:  "---\ntemplating: true\n---\n",
+			NoTemplating: true,
+			Expect:       "<p>Hello WORLD</p>",
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			chdirSite(t, map[string]string{
+				"includes/page.html": "{{ content|safe }}",
+				"pages/about.md":     tcase.FrontMatter + "Hello {{ 'world'|upper }}\n",
+				"public/.keep":       "",
+			})
+
+			c := newTestSiteConfig()
+			c.NoMarkdownTemplating = tcase.NoTemplating
+
+			out := NewMemFS()
+			c.OutputFS = out
+
+			b, err := New(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fb, err := out.ReadFile(filepath.Join("build", "about.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.TrimSpace(string(fb)); got != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, got)
+			}
+		})
+	}
+}
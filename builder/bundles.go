@@ -0,0 +1,197 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BundlePrefix is the prefix of the keys of bundles in the assets map.
+const BundlePrefix = "bundle:"
+
+var (
+	errEmptyBundle    = errors.New("bundle has no inputs")
+	errBundleConflict = errors.New("bundle conflicts with another output")
+)
+
+// Bundle is a set of CSS or JS files in the public dir that are
+// concatenated into a single output.
+type Bundle struct {
+	// Name is the path of the output relative to the output dir. Its
+	// extension determines how the output is minified.
+	Name string
+	// Inputs are paths or glob patterns relative to the public dir. Files
+	// are concatenated in the order they are listed.
+	Inputs []string
+}
+
+// handleBundles writes the configured bundles to the output dir and adds
+// them to publicAssets.
+func (b *Builder) handleBundles(publicAssets map[string]string) error {
+	keys := make(map[string]bool)
+	for key := range publicAssets {
+		keys[key] = true
+	}
+
+	names := make(map[string]bool)
+
+	for _, bundle := range b.config.Bundles {
+		b.counter++
+		b.log.Printf("==> Bundling %q", bundle.Name)
+
+		err := b.checkBundleName(bundle.Name, names, publicAssets)
+		if err != nil {
+			return err
+		}
+
+		inputs, err := b.bundleInputs(bundle)
+		if err != nil {
+			return err
+		}
+
+		// Separate JS files with semicolons so that statements without a
+		// trailing semicolon do not run into the next file
+		sep := []byte("\n")
+		if filepath.Ext(bundle.Name) == ".js" {
+			sep = []byte(";\n")
+		}
+
+		var (
+			content = make([]byte, 0)
+			imports = make([]byte, 0)
+		)
+
+		for _, path := range inputs {
+			fb, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("could not read file %q: %w", path, err)
+			}
+
+			key := relPath(b.config.PublicDir, path)
+
+			fb, err = b.transform(key, path, fb)
+			if err != nil {
+				return err
+			}
+
+			// References are made absolute because the bundle is not in the
+			// same directory as its inputs
+			if re := b.refRegexp(path); re != nil {
+				fb = rewriteAssetRefs(fb, findAssetRefs(re, key, fb, keys), publicAssets, true)
+			}
+
+			// @import rules must come before all other rules, so the rules
+			// of all inputs are moved to the top of the bundle
+			if filepath.Ext(bundle.Name) == ".css" {
+				var rules []byte
+				rules, fb = splitCSSImports(fb)
+				imports = append(imports, rules...)
+			}
+
+			content = append(content, fb...)
+			content = append(content, sep...)
+		}
+
+		content = append(imports, content...)
+
+		outP := filepath.Join(b.config.OutputDir, filepath.FromSlash(bundle.Name))
+
+		err = b.out.MkdirAll(filepath.Dir(outP), os.FileMode(readWriteExecute))
+		if err != nil {
+			return fmt.Errorf("could not create dir for bundle %q: %w", bundle.Name, err)
+		}
+
+		err = b.emitAsset(BundlePrefix+bundle.Name, outP, content, publicAssets)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBundleName returns an error if the output of the bundle name would
+// overwrite a public asset or another bundle in names. The name is added
+// to names.
+func (b *Builder) checkBundleName(name string, names map[string]bool, publicAssets map[string]string) error {
+	if names[name] {
+		return fmt.Errorf("%w: more than one bundle is named %q", errBundleConflict, name)
+	}
+
+	names[name] = true
+
+	for key, outURL := range publicAssets {
+		if key == filepath.FromSlash(name) || outURL == "/"+name {
+			return fmt.Errorf("%w: bundle %q would overwrite %q in %q",
+				errBundleConflict, name, key, b.config.PublicDir)
+		}
+	}
+
+	return nil
+}
+
+// bundleInputs returns the paths of the inputs of bundle in order. Files
+// matched by more than one input are only included once.
+func (b *Builder) bundleInputs(bundle Bundle) ([]string, error) {
+	paths := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, input := range bundle.Inputs {
+		matches, err := filepath.Glob(filepath.Join(b.config.PublicDir, filepath.FromSlash(input)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid input %q of bundle %q: %w", input, bundle.Name, err)
+		}
+
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				continue
+			}
+
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: %q", errEmptyBundle, bundle.Name)
+	}
+
+	return paths, nil
+}
+
+// splitCSSImports returns the top-level @import rules of css and the rest
+// of css, which is left as it is apart from the removed rules. css is
+// returned as is if it has no imports.
+func splitCSSImports(css []byte) ([]byte, []byte) {
+	imports := new(bytes.Buffer)
+	rest := new(bytes.Buffer)
+	last := 0
+
+	for _, n := range parseCSS(string(css)) {
+		if n.block || !strings.HasPrefix(n.text, "@import") {
+			continue
+		}
+
+		imports.WriteString(n.text)
+		imports.WriteString(";\n")
+
+		rest.Write(css[last:n.start])
+		last = n.end
+	}
+
+	if imports.Len() == 0 {
+		return nil, css
+	}
+
+	rest.Write(css[last:])
+
+	return imports.Bytes(), rest.Bytes()
+}
@@ -0,0 +1,143 @@
+package builder
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+func TestBundleConfig(t *testing.T) {
+	c := new(config)
+
+	err := toml.Unmarshal([]byte(`
+[[bundles]]
+name = "main.css"
+inputs = ["css/reset.css", "css/*.css"]
+`), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Bundles) != 1 || c.Bundles[0].Name != "main.css" || len(c.Bundles[0].Inputs) != 2 {
+		t.Errorf("unexpected bundles %+v", c.Bundles)
+	}
+}
+
+func TestHandleBundles(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html":   "{{ content|safe }}",
+		"pages/index.html":     "",
+		"public/css/reset.css": "body { margin: 0 }",
+		"public/css/theme.css": "@import url(\"https://fonts.example.com/a.css\");\nbody { background: url(../img/bg.png) }",
+		"public/img/bg.png":    "png",
+		"public/main.css":      "a { color: red }",
+	})
+
+	tests := []struct {
+		Name    string
+		Bundles []Bundle
+		Expect  string
+		WantErr error
+	}{
+		{
+			Name:    "bundle",
+			Bundles: []Bundle{{Name: "all.css", Inputs: []string{"css/reset.css", "css/*.css"}}},
+			Expect:  `@import "https://fonts.example.com/a.css";body{margin:0}body{background:url(/img/bg.png)}`,
+		},
+		{
+			Name:    "overwrites public file",
+			Bundles: []Bundle{{Name: "main.css", Inputs: []string{"css/*.css"}}},
+			WantErr: errBundleConflict,
+		},
+		{
+			Name: "duplicate name",
+			Bundles: []Bundle{
+				{Name: "all.css", Inputs: []string{"css/reset.css"}},
+				{Name: "all.css", Inputs: []string{"css/theme.css"}},
+			},
+			WantErr: errBundleConflict,
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			c := newTestSiteConfig()
+			c.NoMinify = false
+			c.HashExts = []string{".css"}
+			c.Bundles = tcase.Bundles
+
+			out := NewMemFS()
+			c.OutputFS = out
+
+			b, err := New(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if !errors.Is(err, tcase.WantErr) {
+				t.Fatalf("expected error %v but got %v", tcase.WantErr, err)
+			}
+
+			if tcase.WantErr != nil {
+				return
+			}
+
+			outURL, ok := b.Assets()[BundlePrefix+tcase.Bundles[0].Name]
+			if !ok {
+				t.Fatal("expected bundle in public assets")
+			}
+
+			fb, err := out.ReadFile(filepath.Join("build", filepath.FromSlash(outURL)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(fb) != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, string(fb))
+			}
+		})
+	}
+}
+
+func TestSplitCSSImports(t *testing.T) {
+	tests := []struct {
+		Name    string
+		CSS     string
+		Imports string
+		Rest    string
+	}{
+		{
+			Name: "no imports",
+			CSS:  "/*! license */\nbody { margin: 0 }",
+			Rest: "/*! license */\nbody { margin: 0 }",
+		},
+		{
+			Name:    "imports",
+			CSS:     "/*! license */\n@import \"a.css\";\n@import url('b.css') screen;\n/* body */\nbody { margin: 0 }",
+			Imports: "@import \"a.css\";\n@import url('b.css') screen;\n",
+			Rest:    "/*! license */\n\n\n/* body */\nbody { margin: 0 }",
+		},
+		{
+			Name:    "import without semicolon",
+			CSS:     "a { color: red }\n@import \"a.css\"",
+			Imports: "@import \"a.css\";\n",
+			Rest:    "a { color: red }\n",
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			imports, rest := splitCSSImports([]byte(tcase.CSS))
+			if string(imports) != tcase.Imports {
+				t.Errorf("expected imports %q but got %q", tcase.Imports, imports)
+			}
+
+			if string(rest) != tcase.Rest {
+				t.Errorf("expected rest %q but got %q", tcase.Rest, rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+
+	"github.com/AlexanderRichey/yagss/mini"
+)
+
+var (
+	errRequiredFieldNotFound = errors.New("required field not found in config")
+	errGreaterThan           = errors.New("int value must be greater than 0")
+	errInvalidValue          = errors.New("invalid value in config")
+)
+
+type config struct {
+	Site struct {
+		Title       string `human:"site.title"`
+		Description string `human:"site.description"`
+		URL         string `human:"site.url"`
+	}
+	Directories struct {
+		Includes string `human:"directories.includes"`
+		Pages    string `human:"directories.pages"`
+		Posts    string `human:"directories.posts" optional:""`
+		Public   string `human:"directories.public"`
+		Output   string `human:"directories.output"`
+		Data     string `human:"directories.data" optional:""`
+	}
+	Defaults struct {
+		PageTemplate string `human:"defaults.pageTemplate"`
+		PostTemplate string `human:"defaults.postTemplate" optional:""`
+	}
+	Build struct {
+		PostsIndexPage    string   `human:"build.postsIndexPage" optional:""`
+		PostsPerPage      int      `human:"build.postsPerPage" optional:""`
+		ChromaTheme       string   `human:"build.chromaTheme" optional:""`
+		ChromaLineNumbers bool     `human:"build.chromaLineNumbers"`
+		ChromaWithClasses bool     `human:"build.chromaWithClasses"`
+		RSS               bool     `human:"build.rss"`
+		Hash              []string `human:"build.hash"`
+		Strict            bool     `human:"build.strict"`
+		RewriteJS         bool     `human:"build.rewriteJS"`
+		HashAlgorithm     string   `human:"build.hashAlgorithm" default:"md5"`
+		HashLength        int      `human:"build.hashLength" default:"8"`
+		Manifest          bool     `human:"build.manifest"`
+	}
+	Images struct {
+		Widths  []int  `human:"images.widths"`
+		Quality int    `human:"images.quality" default:"85"`
+		Cache   string `human:"images.cache" default:".yagss-cache/images" optional:""`
+	}
+	Markdown struct {
+		Unsafe          bool     `human:"markdown.unsafe" default:"true"`
+		Templating      bool     `human:"markdown.templating" default:"true"`
+		BrokenLinks     string   `human:"markdown.brokenLinks" optional:""`
+		ImageAttributes bool     `human:"markdown.imageAttributes" default:"true"`
+		Sanitize        bool     `human:"markdown.sanitize"`
+		AllowElements   []string `human:"markdown.allowElements"`
+		AllowAttributes []string `human:"markdown.allowAttributes"`
+	}
+	Minify struct {
+		Enabled                 bool              `human:"minify.enabled" default:"true"`
+		HTML                    bool              `human:"minify.html" default:"true"`
+		CSS                     bool              `human:"minify.css" default:"true"`
+		JS                      bool              `human:"minify.js" default:"true"`
+		SVG                     bool              `human:"minify.svg" default:"true"`
+		JSON                    bool              `human:"minify.json" default:"true"`
+		XML                     bool              `human:"minify.xml" default:"true"`
+		KeepConditionalComments bool              `human:"minify.keepConditionalComments" default:"true"`
+		KeepDefaultAttrVals     bool              `human:"minify.keepDefaultAttrVals"`
+		KeepDocumentTags        bool              `human:"minify.keepDocumentTags" default:"true"`
+		KeepEndTags             bool              `human:"minify.keepEndTags" default:"true"`
+		KeepQuotes              bool              `human:"minify.keepQuotes"`
+		KeepWhitespace          bool              `human:"minify.keepWhitespace"`
+		Extensions              map[string]string `human:"minify.extensions"`
+	}
+	Compress struct {
+		Gzip    bool `human:"compress.gzip"`
+		MinSize int  `human:"compress.minSize" default:"1024" optional:""`
+	}
+	Hooks struct {
+		PreBuild  string             `human:"hooks.preBuild" optional:""`
+		PostBuild string             `human:"hooks.postBuild" optional:""`
+		Transform []TransformCommand `human:"hooks.transform"`
+	}
+	Bundles    []Bundle
+	Transforms []TransformConfig
+}
+
+// ConfigFile is the name of the config file of a site.
+const ConfigFile = "config.toml"
+
+// ReadConfig reads the config file at path. Relative directories in the
+// config are resolved against the directory of the config file.
+func ReadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %q: %w", path, err)
+	}
+
+	// The site is built the same way wherever it is built from
+	for _, dir := range []*string{&c.TemplatesDir, &c.PagesDir, &c.PostsDir, &c.PublicDir,
+		&c.OutputDir, &c.DataDir, &c.ImageCacheDir} {
+		if *dir != "" && !filepath.IsAbs(*dir) {
+			*dir = filepath.Join(filepath.Dir(path), *dir)
+		}
+	}
+
+	return c, nil
+}
+
+// ParseConfig parses a config in TOML format from r.
+func ParseConfig(r io.Reader) (*Config, error) {
+	c := new(config)
+
+	err := toml.NewDecoder(r).Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode config: %w", err)
+	}
+
+	err = check(c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &Config{
+		SiteTitle:            c.Site.Title,
+		SiteDescription:      c.Site.Description,
+		SiteURL:              c.Site.URL,
+		TemplatesDir:         c.Directories.Includes,
+		PagesDir:             c.Directories.Pages,
+		PostsDir:             c.Directories.Posts,
+		PublicDir:            c.Directories.Public,
+		OutputDir:            c.Directories.Output,
+		DataDir:              c.Directories.Data,
+		DefaultPostTemplate:  c.Defaults.PostTemplate,
+		DefaultPageTemplate:  c.Defaults.PageTemplate,
+		ChromaTheme:          c.Build.ChromaTheme,
+		ChromaLineNumbers:    c.Build.ChromaLineNumbers,
+		ChromaWithClasses:    c.Build.ChromaWithClasses,
+		PostsIndex:           c.Build.PostsIndexPage,
+		PostsPerPage:         c.Build.PostsPerPage,
+		RSS:                  c.Build.RSS,
+		HashExts:             c.Build.Hash,
+		Strict:               c.Build.Strict,
+		RewriteJS:            c.Build.RewriteJS,
+		HashAlgorithm:        c.Build.HashAlgorithm,
+		HashLength:           c.Build.HashLength,
+		Manifest:             c.Build.Manifest,
+		Bundles:              c.Bundles,
+		Transforms:           c.Transforms,
+		PreBuildCommand:      c.Hooks.PreBuild,
+		PostBuildCommand:     c.Hooks.PostBuild,
+		TransformCommands:    c.Hooks.Transform,
+		ImageWidths:          c.Images.Widths,
+		ImageQuality:         c.Images.Quality,
+		ImageCacheDir:        c.Images.Cache,
+		MarkdownSafe:         !c.Markdown.Unsafe,
+		Sanitize:             c.Markdown.Sanitize,
+		SanitizeElements:     c.Markdown.AllowElements,
+		SanitizeAttributes:   c.Markdown.AllowAttributes,
+		NoMarkdownTemplating: !c.Markdown.Templating,
+		BrokenLinks:          c.Markdown.BrokenLinks,
+		NoImageAttributes:    !c.Markdown.ImageAttributes,
+		NoMinify:             !c.Minify.Enabled,
+		MinifyDisabledTypes:  c.disabledMinifyTypes(),
+		MinifyHTML: &mini.HTMLOptions{
+			KeepConditionalComments: c.Minify.KeepConditionalComments,
+			KeepDefaultAttrVals:     c.Minify.KeepDefaultAttrVals,
+			KeepDocumentTags:        c.Minify.KeepDocumentTags,
+			KeepEndTags:             c.Minify.KeepEndTags,
+			KeepQuotes:              c.Minify.KeepQuotes,
+			KeepWhitespace:          c.Minify.KeepWhitespace,
+		},
+		MinifyExtensions: c.Minify.Extensions,
+		Gzip:             c.Compress.Gzip,
+		GzipMinSize:      c.Compress.MinSize,
+	}, nil
+}
+
+// disabledMinifyTypes returns the MIME types whose minification is turned
+// off in the minify section.
+func (c *config) disabledMinifyTypes() []string {
+	types := make([]string, 0)
+
+	for _, t := range []struct {
+		enabled bool
+		mimes   []string
+	}{
+		{c.Minify.HTML, []string{"text/html"}},
+		{c.Minify.CSS, []string{"text/css"}},
+		{c.Minify.JS, []string{"application/javascript"}},
+		{c.Minify.SVG, []string{"image/svg+xml"}},
+		{c.Minify.JSON, []string{"application/json", "application/manifest+json"}},
+		{c.Minify.XML, []string{"text/xml", "application/rss+xml"}},
+	} {
+		if !t.enabled {
+			types = append(types, t.mimes...)
+		}
+	}
+
+	return types
+}
+
+func check(c *config) error {
+	// If the posts dir is defined, then the three other fields below most also be defined.
+	if c.Directories.Posts != "" {
+		if c.Defaults.PostTemplate == "" {
+			return fmt.Errorf("%w: %q", errRequiredFieldNotFound, "defaults.postTemplate")
+		}
+
+		if c.Build.PostsIndexPage == "" {
+			return fmt.Errorf("%w: %q", errRequiredFieldNotFound, "build.postsIndexPage")
+		}
+
+		if c.Build.PostsPerPage <= 0 {
+			return fmt.Errorf("%w: %q", errGreaterThan, "build.postsPerPage")
+		}
+	} else {
+		c.Defaults.PostTemplate = ""
+		c.Build.PostsIndexPage = ""
+		c.Build.PostsPerPage = 0
+	}
+
+	if c.Images.Quality > 100 {
+		return fmt.Errorf("%w: %q must be between 1 and 100", errInvalidValue, "images.quality")
+	}
+
+	newHash, ok := hashFuncs[c.Build.HashAlgorithm]
+	if !ok {
+		return fmt.Errorf("%w: %q must be one of %q, %q, %q, or %q", errInvalidValue,
+			"build.hashAlgorithm", "md5", "sha1", "sha256", "sha512")
+	}
+
+	if max := newHash().Size() * 2; c.Build.HashLength > max {
+		return fmt.Errorf("%w: %q must be between 1 and %d", errInvalidValue, "build.hashLength", max)
+	}
+
+	for _, bundle := range c.Bundles {
+		if ext := filepath.Ext(bundle.Name); ext != ".css" && ext != ".js" {
+			return fmt.Errorf("%w: %q must end with %q or %q", errInvalidValue, "bundles.name", ".css", ".js")
+		}
+
+		if len(bundle.Inputs) == 0 {
+			return fmt.Errorf("%w: %q", errRequiredFieldNotFound, "bundles.inputs")
+		}
+	}
+
+	for _, tc := range c.Transforms {
+		if tc.Pattern == "" {
+			return fmt.Errorf("%w: %q", errRequiredFieldNotFound, "transforms.pattern")
+		}
+
+		if _, ok := builtinTransformers[tc.Use]; !ok {
+			return fmt.Errorf("%w: %q: %q", errUnknownTransformer, "transforms.use", tc.Use)
+		}
+	}
+
+	for _, tc := range c.Hooks.Transform {
+		if tc.Pattern == "" {
+			return fmt.Errorf("%w: %q", errRequiredFieldNotFound, "hooks.transform.pattern")
+		}
+
+		if tc.Command == "" {
+			return fmt.Errorf("%w: %q", errRequiredFieldNotFound, "hooks.transform.command")
+		}
+	}
+
+	for ext, mime := range c.Minify.Extensions {
+		if !strings.HasPrefix(ext, ".") || mime == "" {
+			return fmt.Errorf("%w: %q must map extensions starting with a dot to MIME types",
+				errInvalidValue, "minify.extensions")
+		}
+	}
+
+	switch c.Markdown.BrokenLinks {
+	case "", BrokenLinksWarn, BrokenLinksError:
+	default:
+		return fmt.Errorf("%w: %q must be %q or %q", errInvalidValue,
+			"markdown.brokenLinks", BrokenLinksWarn, BrokenLinksError)
+	}
+
+	return checkrec(c)
+}
+
+func checkrec(c interface{}) error {
+	cv := reflect.Indirect(reflect.ValueOf(c))
+	vt := cv.Type()
+
+	for i := 0; i < cv.NumField(); i++ {
+		switch cv.Field(i).Kind() {
+		case reflect.Struct:
+			err := checkrec(cv.Field(i).Interface())
+			if err != nil {
+				return err
+			}
+		case reflect.String:
+			if len(cv.Field(i).String()) == 0 {
+				if _, found := vt.Field(i).Tag.Lookup("optional"); found {
+					continue
+				}
+
+				return fmt.Errorf("%w: %q", errRequiredFieldNotFound, vt.Field(i).Tag.Get("human"))
+			}
+		case reflect.Int:
+			if val := cv.Field(i).Int(); val <= 0 {
+				if _, found := vt.Field(i).Tag.Lookup("optional"); found && val == 0 {
+					continue
+				}
+
+				return fmt.Errorf("%w: %q", errGreaterThan, vt.Field(i).Tag.Get("human"))
+			}
+		default:
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package builder
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheck makes sure that config parsing fails when it should,
+// but it doesn't test all cases.
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		Name      string
+		ExpectErr bool
+		GetConfig func() *config
+	}{
+		{
+			Name:      "valid default",
+			ExpectErr: false,
+			GetConfig: func() *config { return newValidConfig() },
+		},
+		{
+			Name:      "valid without posts dir",
+			ExpectErr: false,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Directories.Posts = ""
+				return c
+			},
+		},
+		{
+			Name:      "invalid: negative posts per page",
+			ExpectErr: false,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Build.PostsPerPage = -1
+				return c
+			},
+		},
+		{
+			Name:      "invalid: missing post template",
+			ExpectErr: false,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Defaults.PostTemplate = ""
+				return c
+			},
+		},
+		{
+			Name:      "invalid: missing page template",
+			ExpectErr: false,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Defaults.PageTemplate = ""
+				return c
+			},
+		},
+		{
+			Name:      "invalid: site name",
+			ExpectErr: false,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Site.Title = ""
+				return c
+			},
+		},
+		{
+			Name:      "invalid: broken links setting",
+			ExpectErr: true,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Markdown.BrokenLinks = "ignore"
+				return c
+			},
+		},
+		{
+			Name:      "invalid: minify extension without dot",
+			ExpectErr: true,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Minify.Extensions = map[string]string{"mjs": "application/javascript"}
+				return c
+			},
+		},
+		{
+			Name:      "invalid: hash algorithm",
+			ExpectErr: true,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Build.HashAlgorithm = "crc32"
+				return c
+			},
+		},
+		{
+			Name:      "invalid: hash length longer than hash",
+			ExpectErr: true,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Build.HashAlgorithm = "md5"
+				c.Build.HashLength = 33
+				return c
+			},
+		},
+		{
+			Name:      "invalid: transform command without command",
+			ExpectErr: true,
+			GetConfig: func() *config {
+				c := newValidConfig()
+				c.Hooks.Transform = []TransformCommand{{Pattern: "*.ts"}}
+				return c
+			},
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			c := tcase.GetConfig()
+			err := check(c)
+			if tcase.ExpectErr && err == nil {
+				t.Error("expected error but did not get one")
+			}
+		})
+	}
+}
+
+func newValidConfig() *config {
+	c := new(config)
+	c.Site.Title = "test"
+	c.Site.Description = "my description"
+	c.Site.URL = "http://localhost"
+	c.Directories.Includes = "includes"
+	c.Directories.Pages = "pages"
+	c.Directories.Posts = "posts"
+	c.Directories.Public = "public"
+	c.Directories.Output = "build"
+	c.Defaults.PageTemplate = "page.html"
+	c.Defaults.PostTemplate = "post.html"
+	c.Build.PostsIndexPage = "index.html"
+	c.Build.PostsPerPage = 3
+	c.Build.ChromaTheme = "friendly"
+	c.Build.ChromaLineNumbers = false
+	c.Build.Hash = []string{".js", ".css"}
+	c.Build.HashAlgorithm = "sha256"
+	c.Build.HashLength = 12
+	c.Build.RSS = true
+	return c
+}
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig(strings.NewReader(`
+[site]
+title = "test"
+description = "my description"
+url = "http://localhost"
+
+[directories]
+includes = "includes"
+pages = "pages"
+public = "public"
+output = "build"
+
+[defaults]
+pageTemplate = "page.html"
+
+[build]
+hash = [".css"]
+
+[hooks]
+postBuild = "indexer build"
+
+[[hooks.transform]]
+pattern = "*.ts"
+command = "tsc"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.SiteTitle != "test" || c.OutputDir != "build" {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	if c.ImageQuality != 85 || c.HashAlgorithm != DefaultHashAlgorithm || c.HashLength != DefaultHashLength {
+		t.Errorf("expected defaults to be set but got %+v", c)
+	}
+
+	if c.PostBuildCommand != "indexer build" || len(c.TransformCommands) != 1 ||
+		c.TransformCommands[0].Command != "tsc" {
+		t.Errorf("expected hooks to be set but got %+v", c)
+	}
+
+	_, err = ParseConfig(strings.NewReader(`[site]`))
+	if err == nil {
+		t.Error("expected error but did not get one")
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"site/" + ConfigFile: `
+[site]
+title = "test"
+description = "my description"
+url = "http://localhost"
+
+[directories]
+includes = "includes"
+pages = "pages"
+posts = "posts"
+public = "public"
+output = "build"
+
+[defaults]
+pageTemplate = "page.html"
+postTemplate = "post.html"
+
+[build]
+hash = [".css"]
+postsIndexPage = "blog.html"
+postsPerPage = 1
+`,
+		"site/includes/page.html":  "{{ content|safe }}",
+		"site/includes/post.html":  "{{ url }}",
+		"site/pages/docs/index.md": "[post](../../posts/hello.md) {{ assets|key:'css/a.css' }}",
+		"site/pages/blog.html":     "{% for p in posts %}{{ p.Path }}{% endfor %}|{{ prev }}",
+		"site/posts/hello.md":      "---\ntitle: Hello\ndate: 2021-01-02\n---\nhi",
+		"site/posts/bye.md":        "---\ntitle: Bye\ndate: 2021-01-03\n---\nbye",
+		"site/public/css/a.css":    "a{}",
+	})
+
+	c, err := ReadConfig(filepath.Join("site", ConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := filepath.Join("site", ".yagss-cache", "images"); c.ImageCacheDir != expect {
+		t.Errorf("expected image cache dir %q but got %q", expect, c.ImageCacheDir)
+	}
+
+	out := NewMemFS()
+	c.OutputFS = out
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expect := range map[string]string{
+		"docs/index.html":  `<a href=/posts/hello.html>post</a> /css/a.`,
+		"posts/hello.html": "/posts/hello.html",
+		"blog.html":        "/posts/bye.html|",
+		"page2/index.html": "/posts/hello.html|/blog.html",
+	} {
+		fb, err := out.ReadFile(filepath.Join("site", "build", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(fb), expect) {
+			t.Errorf("expected %q in %q", expect, fb)
+		}
+	}
+}
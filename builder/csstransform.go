@@ -0,0 +1,533 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	errCircularImport    = errors.New("circular import")
+	errUndefinedVariable = errors.New("undefined variable")
+)
+
+var (
+	// cssImportRegexp matches the target of an @import statement.
+	cssImportRegexp = regexp.MustCompile(`^@import\s+(?:url\(\s*)?(?:"([^"]*)"|'([^']*)')`)
+	// cssVarDefRegexp matches a Sass-style variable definition such as
+	// $accent: red.
+	cssVarDefRegexp = regexp.MustCompile(`(?s)^\$([A-Za-z_][\w-]*)\s*:\s*(.*?)(\s*!default)?$`)
+	// cssVarRegexp matches the name of a variable at the start of a string.
+	cssVarRegexp = regexp.MustCompile(`^\$([A-Za-z_][\w-]*)`)
+)
+
+// cssTransformer is the built-in transformer that inlines imported
+// partials, substitutes Sass-style variables, and flattens nested rules.
+// Partials are CSS files whose names start with an underscore.
+type cssTransformer struct {
+	globMatcher
+}
+
+func newCSSTransformer(pattern string) Transformer {
+	return &cssTransformer{globMatcher: globMatcher(pattern)}
+}
+
+func (t *cssTransformer) IsPartial(key string) bool {
+	return strings.HasPrefix(path.Base(key), "_")
+}
+
+func (t *cssTransformer) Transform(path string, content []byte) ([]byte, error) {
+	nodes, err := t.parse(path, content, map[string]bool{filepath.Clean(path): true})
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err = resolveCSSVars(nodes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve variables in %q: %w", path, err)
+	}
+
+	// Browsers ignore imports that come after other rules, which remaining
+	// imports may do once partials are inlined
+	isHead := func(n *cssNode) bool {
+		return !n.block && (strings.HasPrefix(n.text, "@charset") || strings.HasPrefix(n.text, "@import"))
+	}
+
+	sorted := make([]*cssNode, 0, len(nodes))
+	for _, n := range nodes {
+		if isHead(n) {
+			sorted = append(sorted, n)
+		}
+	}
+
+	for _, n := range nodes {
+		if !isHead(n) {
+			sorted = append(sorted, n)
+		}
+	}
+
+	sb := new(strings.Builder)
+	flattenCSS(sb, nil, sorted)
+
+	return []byte(sb.String()), nil
+}
+
+// parse parses content and replaces imports of partials with their parsed
+// content. seen holds the files that are being imported, which is used to
+// detect circular imports.
+func (t *cssTransformer) parse(path string, content []byte, seen map[string]bool) ([]*cssNode, error) {
+	nodes := parseCSS(string(content))
+
+	out := make([]*cssNode, 0, len(nodes))
+	for _, n := range nodes {
+		partialP := t.resolveImport(path, n)
+		if partialP == "" {
+			out = append(out, n)
+			continue
+		}
+
+		if seen[partialP] {
+			return nil, fmt.Errorf("%w: %q in %q", errCircularImport, partialP, path)
+		}
+
+		fb, err := ioutil.ReadFile(partialP)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file %q: %w", partialP, err)
+		}
+
+		// References in the partial are relative to the partial, but they
+		// end up in the importing file
+		fb = rebaseCSSRefs(fb, filepath.Dir(partialP), filepath.Dir(path))
+
+		seen[partialP] = true
+		imported, err := t.parse(partialP, fb, seen)
+		delete(seen, partialP)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, imported...)
+	}
+
+	return out, nil
+}
+
+// resolveImport returns the path of the partial that n imports, or an empty
+// string if n is not an import of a partial. Like Sass, the underscore and
+// extension of partials may be omitted.
+func (t *cssTransformer) resolveImport(path string, n *cssNode) string {
+	if n.block {
+		return ""
+	}
+
+	m := cssImportRegexp.FindStringSubmatch(n.text)
+	if m == nil {
+		return ""
+	}
+
+	target := m[1] + m[2]
+
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return ""
+	}
+
+	dir, name := filepath.Split(filepath.Join(filepath.Dir(path), filepath.FromSlash(u.Path)))
+	if filepath.Ext(name) != ".css" {
+		name += ".css"
+	}
+
+	// Only partials are inlined
+	if !strings.HasPrefix(name, "_") {
+		name = "_" + name
+	}
+
+	p := filepath.Join(dir, name)
+	if info, err := os.Stat(p); err != nil || info.IsDir() {
+		return ""
+	}
+
+	return p
+}
+
+// resolveCSSVars returns nodes with Sass-style variables substituted and
+// their definitions removed. vars holds the variables of the enclosing
+// blocks. Like in Sass, a variable is defined from its definition to the
+// end of the block it is defined in, and a definition with !default only
+// takes effect if the variable is not defined yet.
+func resolveCSSVars(nodes []*cssNode, vars map[string]string) ([]*cssNode, error) {
+	scope := make(map[string]string, len(vars))
+	for k, v := range vars {
+		scope[k] = v
+	}
+
+	out := make([]*cssNode, 0, len(nodes))
+	for _, n := range nodes {
+		if m := cssVarDefRegexp.FindStringSubmatch(n.text); !n.block && m != nil {
+			if _, ok := scope[m[1]]; ok && m[3] != "" {
+				continue
+			}
+
+			val, err := substituteCSSVars(m[2], scope)
+			if err != nil {
+				return nil, err
+			}
+
+			scope[m[1]] = val
+
+			continue
+		}
+
+		text, err := substituteCSSVars(n.text, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved := &cssNode{text: text, block: n.block, start: n.start, end: n.end}
+
+		if n.block {
+			resolved.children, err = resolveCSSVars(n.children, scope)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		out = append(out, resolved)
+	}
+
+	return out, nil
+}
+
+// substituteCSSVars replaces the variables in text with their values in
+// vars. Strings are left as they are.
+func substituteCSSVars(text string, vars map[string]string) (string, error) {
+	if !strings.Contains(text, "$") {
+		return text, nil
+	}
+
+	sb := new(strings.Builder)
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		switch c {
+		case '"', '\'':
+			end := i + 1
+			for end < len(text) && text[end] != c {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+
+			if end >= len(text) {
+				end = len(text) - 1
+			}
+
+			sb.WriteString(text[i : end+1])
+			i = end + 1
+
+			continue
+		case '$':
+			if m := cssVarRegexp.FindStringSubmatch(text[i:]); m != nil {
+				val, ok := vars[m[1]]
+				if !ok {
+					return "", fmt.Errorf("%w: %q", errUndefinedVariable, m[0])
+				}
+
+				sb.WriteString(val)
+				i += len(m[0])
+
+				continue
+			}
+		}
+
+		sb.WriteByte(c)
+		i++
+	}
+
+	return sb.String(), nil
+}
+
+// rebaseCSSRefs rewrites the relative url() references in content from
+// being relative to fromDir to being relative to toDir.
+func rebaseCSSRefs(content []byte, fromDir, toDir string) []byte {
+	if fromDir == toDir {
+		return content
+	}
+
+	return cssRefRegexp.ReplaceAllFunc(content, func(m []byte) []byte {
+		sub := cssRefRegexp.FindSubmatchIndex(m)
+
+		// Only url() references, which are in the first three groups, are
+		// rebased. Imports are resolved relative to their partial.
+		for i := 2; i < 8; i += 2 {
+			if sub[i] < 0 {
+				continue
+			}
+
+			ref := string(m[sub[i]:sub[i+1]])
+
+			u, err := url.Parse(ref)
+			if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+				return m
+			}
+
+			rel, err := filepath.Rel(toDir, filepath.Join(fromDir, filepath.FromSlash(u.Path)))
+			if err != nil {
+				return m
+			}
+
+			rebased := filepath.ToSlash(rel) + ref[len(u.Path):]
+
+			out := make([]byte, 0, len(m))
+			out = append(out, m[:sub[i]]...)
+			out = append(out, rebased...)
+
+			return append(out, m[sub[i+1]:]...)
+		}
+
+		return m
+	})
+}
+
+// cssNode is a statement or a block in a stylesheet.
+type cssNode struct {
+	// text is the statement, or the prelude of the block, such as a
+	// selector or an at-rule
+	text     string
+	block    bool
+	children []*cssNode
+	// start and end are the offsets of a statement in the parsed source,
+	// including its semicolon
+	start int
+	end   int
+}
+
+// parseCSS parses css into a tree of statements and blocks. Comments are
+// removed.
+func parseCSS(css string) []*cssNode {
+	nodes, _ := parseCSSBlock(css, 0)
+
+	return nodes
+}
+
+// parseCSSBlock parses the statements and blocks in css from i until the
+// end of the enclosing block. It returns the nodes and the position after
+// the end of the block.
+func parseCSSBlock(css string, i int) ([]*cssNode, int) {
+	nodes := make([]*cssNode, 0)
+	buf := new(strings.Builder)
+	parens := 0
+	start := -1
+
+	flush := func(end int) {
+		if text := strings.TrimSpace(buf.String()); text != "" {
+			nodes = append(nodes, &cssNode{text: text, start: start, end: end})
+		}
+
+		buf.Reset()
+		start = -1
+	}
+
+	for i < len(css) {
+		c := css[i]
+
+		if start < 0 && !isCSSSpace(c) && !strings.HasPrefix(css[i:], "/*") {
+			start = i
+		}
+
+		switch {
+		case c == '/' && strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				return nodes, len(css)
+			}
+
+			i += end + 4
+
+			continue
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(css) && css[end] != c {
+				if css[end] == '\\' {
+					end++
+				}
+				end++
+			}
+
+			if end >= len(css) {
+				end = len(css) - 1
+			}
+
+			buf.WriteString(css[i : end+1])
+			i = end + 1
+
+			continue
+		case c == '(':
+			parens++
+		case c == ')' && parens > 0:
+			parens--
+		case c == ';' && parens == 0:
+			flush(i + 1)
+			i++
+
+			continue
+		case c == '{':
+			text := strings.TrimSpace(buf.String())
+			buf.Reset()
+			start = -1
+
+			children, next := parseCSSBlock(css, i+1)
+			nodes = append(nodes, &cssNode{text: text, block: true, children: children})
+			i = next
+
+			continue
+		case c == '}':
+			flush(i)
+
+			return nodes, i + 1
+		}
+
+		buf.WriteByte(c)
+		i++
+	}
+
+	flush(i)
+
+	return nodes, i
+}
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// flattenCSS writes nodes to sb with nested style rules flattened. The
+// selectors of nested rules are combined with selectors, the selectors of
+// the enclosing rule. Nested conditional at-rules such as @media are
+// hoisted and wrap the enclosing rule.
+func flattenCSS(sb *strings.Builder, selectors []string, nodes []*cssNode) {
+	// Declarations of the enclosing rule come before its nested rules
+	if selectors != nil {
+		decls := make([]string, 0)
+		for _, n := range nodes {
+			if !n.block {
+				decls = append(decls, n.text)
+			}
+		}
+
+		if len(decls) > 0 {
+			sb.WriteString(strings.Join(selectors, ","))
+			sb.WriteString("{")
+			sb.WriteString(strings.Join(decls, ";"))
+			sb.WriteString("}\n")
+		}
+	}
+
+	for _, n := range nodes {
+		switch {
+		case !n.block:
+			if selectors == nil {
+				sb.WriteString(n.text)
+				sb.WriteString(";\n")
+			}
+		case strings.HasPrefix(n.text, "@"):
+			if !isConditionalAtRule(n.text) {
+				writeCSS(sb, n)
+				sb.WriteString("\n")
+
+				continue
+			}
+
+			sb.WriteString(n.text)
+			sb.WriteString("{\n")
+			flattenCSS(sb, selectors, n.children)
+			sb.WriteString("}\n")
+		default:
+			flattenCSS(sb, combineSelectors(selectors, splitSelectors(n.text)), n.children)
+		}
+	}
+}
+
+// writeCSS writes n to sb as is.
+func writeCSS(sb *strings.Builder, n *cssNode) {
+	sb.WriteString(n.text)
+
+	if !n.block {
+		return
+	}
+
+	sb.WriteString("{")
+	for i, c := range n.children {
+		if i > 0 && !n.children[i-1].block {
+			sb.WriteString(";")
+		}
+
+		writeCSS(sb, c)
+	}
+	sb.WriteString("}")
+}
+
+// isConditionalAtRule reports whether the at-rule prelude text is one
+// whose block contains style rules.
+func isConditionalAtRule(text string) bool {
+	for _, name := range []string{"@media", "@supports", "@container", "@layer", "@document"} {
+		if text == name || strings.HasPrefix(text, name+" ") || strings.HasPrefix(text, name+"(") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitSelectors splits a selector list on the commas that are not inside
+// parentheses or brackets.
+func splitSelectors(text string) []string {
+	selectors := make([]string, 0)
+	depth := 0
+	last := 0
+
+	for i, c := range text {
+		switch c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				selectors = append(selectors, strings.TrimSpace(text[last:i]))
+				last = i + 1
+			}
+		}
+	}
+
+	return append(selectors, strings.TrimSpace(text[last:]))
+}
+
+// combineSelectors returns the selectors of rules nested in a rule with
+// the selectors parents. An ampersand in a nested selector refers to the
+// parent selector; otherwise, the nested selector is a descendant of it.
+func combineSelectors(parents, children []string) []string {
+	if parents == nil {
+		return children
+	}
+
+	combined := make([]string, 0, len(parents)*len(children))
+	for _, p := range parents {
+		for _, c := range children {
+			if strings.Contains(c, "&") {
+				combined = append(combined, strings.ReplaceAll(c, "&", p))
+			} else {
+				combined = append(combined, p+" "+c)
+			}
+		}
+	}
+
+	return combined
+}
@@ -0,0 +1,174 @@
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlattenCSS(t *testing.T) {
+	tests := []struct {
+		Input  string
+		Expect string
+	}{
+		{
+			Input:  `a { color: red; }`,
+			Expect: "a{color: red}\n",
+		},
+		{
+			Input:  `.nav, .menu { margin: 0; a { color: red } &:hover { color: blue } > li { padding: 0 } }`,
+			Expect: ".nav,.menu{margin: 0}\n.nav a,.menu a{color: red}\n.nav:hover,.menu:hover{color: blue}\n.nav > li,.menu > li{padding: 0}\n",
+		},
+		{
+			Input:  `.card { padding: 1em; @media (min-width: 40em) { padding: 2em; .title { font-size: 2em } } }`,
+			Expect: ".card{padding: 1em}\n@media (min-width: 40em){\n.card{padding: 2em}\n.card .title{font-size: 2em}\n}\n",
+		},
+		{
+			Input:  `@charset "utf-8"; /* a { b } */ @keyframes spin { from { opacity: 0 } to { opacity: 1 } }`,
+			Expect: "@charset \"utf-8\";\n@keyframes spin{from{opacity: 0}to{opacity: 1}}\n",
+		},
+		{
+			Input:  `:is(a, b) { c { content: "{;}"; background: url(data:image/png;base64,AA==) } }`,
+			Expect: ":is(a, b) c{content: \"{;}\";background: url(data:image/png;base64,AA==)}\n",
+		},
+	}
+
+	for _, tcase := range tests {
+		out, err := newCSSTransformer("*.css").Transform("styles.css", []byte(tcase.Input))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if string(out) != tcase.Expect {
+			t.Errorf("expected %q but got %q", tcase.Expect, string(out))
+		}
+	}
+}
+
+func TestCSSVariables(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Input  string
+		Expect string
+		Err    error
+	}{
+		{
+			Name:   "top level",
+			Input:  `$accent: #c00; $pad: 1em; a { color: $accent; padding: $pad calc($pad * 2) }`,
+			Expect: "a{color: #c00;padding: 1em calc(1em * 2)}\n",
+		},
+		{
+			Name:   "in blocks",
+			Input:  `$c: red; .a { $c: blue; color: $c; b { color: $c } } .b { color: $c }`,
+			Expect: ".a{color: blue}\n.a b{color: blue}\n.b{color: red}\n",
+		},
+		{
+			Name:   "defined with variables",
+			Input:  `$base: 4px; $gap: $base * 2; a { margin: calc($gap) }`,
+			Expect: "a{margin: calc(4px * 2)}\n",
+		},
+		{
+			Name:   "default",
+			Input:  `$c: red; $c: blue !default; $d: green !default; a { color: $c; background: $d }`,
+			Expect: "a{color: red;background: green}\n",
+		},
+		{
+			Name:   "media query and strings",
+			Input:  `$bp: 40em; @media (min-width: $bp) { a[href$=".pdf"] { content: "$bp" } }`,
+			Expect: "@media (min-width: 40em){\na[href$=\".pdf\"]{content: \"$bp\"}\n}\n",
+		},
+		{
+			Name:  "undefined",
+			Input: `.a { $c: red } .b { color: $c }`,
+			Err:   errUndefinedVariable,
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			out, err := newCSSTransformer("*.css").Transform("styles.css", []byte(tcase.Input))
+			if !errors.Is(err, tcase.Err) {
+				t.Fatalf("expected error %v but got %v", tcase.Err, err)
+			}
+
+			if string(out) != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, string(out))
+			}
+		})
+	}
+}
+
+func TestCSSImports(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"css/styles.css":            `@import "partials/buttons"; @import "https://example.com/x.css"; body { margin: 0 }`,
+		"css/partials/_buttons.css": `@import "_colors.css"; .btn { background: url(../../img/btn.png); &:hover { color: var(--accent) } }`,
+		"css/partials/_colors.css":  `$accent: red; :root { --accent: $accent }`,
+		"css/cycle.css":             `@import "_a";`,
+		"css/_a.css":                `@import "_b";`,
+		"css/_b.css":                `@import "_a";`,
+	}
+
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+
+		err := os.MkdirAll(filepath.Dir(path), os.FileMode(readWriteExecute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, []byte(content), os.FileMode(readWrite))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tr := newCSSTransformer("*.css")
+
+	stylesP := filepath.Join(dir, "css", "styles.css")
+	out, err := tr.Transform(stylesP, []byte(files["css/styles.css"]))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expect := "@import \"https://example.com/x.css\";\n" +
+		":root{--accent: red}\n" +
+		".btn{background: url(../img/btn.png)}\n" +
+		".btn:hover{color: var(--accent)}\n" +
+		"body{margin: 0}\n"
+	if string(out) != expect {
+		t.Errorf("expected %q but got %q", expect, string(out))
+	}
+
+	cycleP := filepath.Join(dir, "css", "cycle.css")
+	_, err = tr.Transform(cycleP, []byte(files["css/cycle.css"]))
+	if !errors.Is(err, errCircularImport) {
+		t.Errorf("expected circular import error but got %v", err)
+	}
+
+	if p, ok := tr.(partialer); !ok || !p.IsPartial("css/_a.css") || p.IsPartial("css/styles.css") {
+		t.Error("expected files starting with an underscore to be partials")
+	}
+}
+
+func TestGlobMatcher(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Key     string
+		Expect  bool
+	}{
+		{Pattern: "*.css", Key: "css/styles.css", Expect: true},
+		{Pattern: "css/*.css", Key: "css/styles.css", Expect: true},
+		{Pattern: "css/*.css", Key: "vendor/styles.css", Expect: false},
+		{Pattern: "*.css", Key: "app.js", Expect: false},
+	}
+
+	for _, tcase := range tests {
+		if out := globMatcher(tcase.Pattern).Match(tcase.Key); out != tcase.Expect {
+			t.Errorf("expected %q to match %q: %v but got %v", tcase.Pattern, tcase.Key, tcase.Expect, out)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+var errDataConflict = errors.New("data file conflicts with another data file or directory")
+
+// dataDecoders maps the extensions of data files to their decoders.
+var dataDecoders = map[string]func(b []byte) (interface{}, error){
+	".toml": decodeTOMLData,
+	".json": decodeJSONData,
+	".yaml": decodeYAMLData,
+	".yml":  decodeYAMLData,
+	".csv":  decodeCSVData,
+}
+
+// loadData loads the data files in dir into a nested map. Directories and
+// files are keyed by their names without extension, so that the file
+// team/members.yaml is at data["team"]["members"]. Files with other
+// extensions are ignored.
+func loadData(dir string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		decode, ok := dataDecoders[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		fb, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read data file %q: %w", path, err)
+		}
+
+		val, err := decode(fb)
+		if err != nil {
+			return fmt.Errorf("could not decode data file %q: %w", path, err)
+		}
+
+		// Walk down to the map of the dir of the file, creating maps
+		// for dirs along the way
+		keys := strings.Split(strings.TrimSuffix(rel, filepath.Ext(rel)), string(os.PathSeparator))
+		m := data
+		for _, k := range keys[:len(keys)-1] {
+			next, ok := m[k]
+			if !ok {
+				next = make(map[string]interface{})
+				m[k] = next
+			}
+
+			m, ok = next.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%w: %q", errDataConflict, path)
+			}
+		}
+
+		k := keys[len(keys)-1]
+		if _, ok := m[k]; ok {
+			return fmt.Errorf("%w: %q", errDataConflict, path)
+		}
+
+		m[k] = val
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking data dir: %w", err)
+	}
+
+	return data, nil
+}
+
+func decodeTOMLData(b []byte) (interface{}, error) {
+	tree, err := toml.LoadBytes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree.ToMap(), nil
+}
+
+func decodeJSONData(b []byte) (interface{}, error) {
+	var val interface{}
+
+	err := json.Unmarshal(b, &val)
+
+	return val, err
+}
+
+func decodeYAMLData(b []byte) (interface{}, error) {
+	var val interface{}
+
+	err := yaml.Unmarshal(b, &val)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalizeYAML(val), nil
+}
+
+// normalizeYAML replaces the map[interface{}]interface{} values that yaml
+// decodes mappings into with map[string]interface{} values, like those of
+// the other data formats.
+func normalizeYAML(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(e)
+		}
+
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeYAML(v[i])
+		}
+
+		return v
+	default:
+		return v
+	}
+}
+
+// decodeCSVData decodes a CSV file into a list of records. The first row
+// names the fields of the records.
+func decodeCSVData(b []byte) (interface{}, error) {
+	rows, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]interface{}, 0)
+	if len(rows) == 0 {
+		return records, nil
+	}
+
+	header := rows[0]
+	for _, row := range rows[1:] {
+		rec := make(map[string]interface{}, len(header))
+		for i, field := range header {
+			rec[field] = row[i]
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
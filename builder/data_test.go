@@ -0,0 +1,140 @@
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+func TestLoadData(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Files   map[string]string
+		Expect  map[string]interface{}
+		WantErr error
+	}{
+		{
+			Name: "formats",
+			Files: map[string]string{
+				"site.toml":  "name = \"yagss\"\n[owner]\nname = \"Alex\"\n",
+				"links.json": `[{"url": "https://example.com"}]`,
+				"team.yaml":  "members:\n  - name: Ann\n    role: dev\n",
+				"talks.csv":  "title,year\nGo,2020\nTOML,2021\n",
+				"notes.txt":  "ignored",
+			},
+			Expect: map[string]interface{}{
+				"site": map[string]interface{}{
+					"name":  "yagss",
+					"owner": map[string]interface{}{"name": "Alex"},
+				},
+				"links": []interface{}{
+					map[string]interface{}{"url": "https://example.com"},
+				},
+				"team": map[string]interface{}{
+					"members": []interface{}{
+						map[string]interface{}{"name": "Ann", "role": "dev"},
+					},
+				},
+				"talks": []interface{}{
+					map[string]interface{}{"title": "Go", "year": "2020"},
+					map[string]interface{}{"title": "TOML", "year": "2021"},
+				},
+			},
+		},
+		{
+			Name: "nested dirs",
+			Files: map[string]string{
+				"conf/2021/speakers.yml": "- Ann\n- Bob\n",
+			},
+			Expect: map[string]interface{}{
+				"conf": map[string]interface{}{
+					"2021": map[string]interface{}{
+						"speakers": []interface{}{"Ann", "Bob"},
+					},
+				},
+			},
+		},
+		{
+			Name: "conflict",
+			Files: map[string]string{
+				"team.yaml":  "name: a",
+				"team.json":  `{"name": "b"}`,
+				"other.toml": "",
+			},
+			WantErr: errDataConflict,
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for name, content := range tcase.Files {
+				p := filepath.Join(dir, filepath.FromSlash(name))
+
+				err := os.MkdirAll(filepath.Dir(p), 0777)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = ioutil.WriteFile(p, []byte(content), 0666)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data, err := loadData(dir)
+			if tcase.WantErr != nil {
+				if !errors.Is(err, tcase.WantErr) {
+					t.Fatalf("expected %v but got %v", tcase.WantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(data, tcase.Expect) {
+				t.Errorf("expected %#v but got %#v", tcase.Expect, data)
+			}
+		})
+	}
+}
+
+func TestDataInTemplates(t *testing.T) {
+	dir := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "team.yaml"), []byte("members:\n  - name: Ann\n  - name: Bob\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := loadData(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := pongo2.NewSet("test", pongo2.MustNewLocalFileSystemLoader(dir))
+	set.Globals["data"] = data
+
+	tpl, err := set.FromString("{% for m in data.team.members %}{{ m.name }};{% endfor %}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := tpl.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s != "Ann;Bob;" {
+		t.Errorf("expected %q but got %q", "Ann;Bob;", s)
+	}
+}
@@ -0,0 +1,101 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml"
+)
+
+// DefaultsFile is the name of the files in the pages and posts dirs that
+// set default front matter for the markdown files in their directory and
+// its subdirectories.
+const DefaultsFile = "_defaults.toml"
+
+// withDefaults returns the front matter of the markdown file at path with
+// the defaults of its directory filled in.
+func (b *Builder) withDefaults(path string, frontMatter map[string]string) (map[string]string, error) {
+	defaults, err := b.dirDefaults(filepath.Dir(filepath.Clean(path)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(defaults) == 0 {
+		return frontMatter, nil
+	}
+
+	merged := make(map[string]string, len(defaults)+len(frontMatter))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+
+	for k, v := range frontMatter {
+		merged[k] = v
+	}
+
+	return merged, nil
+}
+
+// dirDefaults returns the default front matter of dir. Defaults cascade
+// from the pages or posts dir down, so the defaults file of a directory
+// overrides the defaults of its parents. Defaults are read once per build.
+func (b *Builder) dirDefaults(dir string) (map[string]string, error) {
+	if defaults, ok := b.defaults[dir]; ok {
+		return defaults, nil
+	}
+
+	defaults := make(map[string]string)
+
+	// Start with the defaults of the parent dir unless dir is a root
+	parent := filepath.Dir(dir)
+	if !b.isContentRoot(dir) && parent != dir {
+		inherited, err := b.dirDefaults(parent)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range inherited {
+			defaults[k] = v
+		}
+	}
+
+	defaultsP := filepath.Join(dir, DefaultsFile)
+
+	tree, err := toml.LoadFile(defaultsP)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read defaults %q: %w", defaultsP, err)
+	}
+
+	if err == nil {
+		own, err := msi2mss(tree.ToMap())
+		if err != nil {
+			return nil, fmt.Errorf("could not process defaults %q: %w", defaultsP, err)
+		}
+
+		for k, v := range own {
+			defaults[k] = v
+		}
+	}
+
+	b.defaults[dir] = defaults
+
+	return defaults, nil
+}
+
+// isContentRoot reports whether dir is the pages or posts dir, where
+// defaults stop cascading.
+func (b *Builder) isContentRoot(dir string) bool {
+	for _, root := range []string{b.config.PagesDir, b.config.PostsDir} {
+		if root != "" && dir == filepath.Clean(root) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDefaultsFile reports whether path is a defaults file.
+func isDefaultsFile(path string) bool {
+	return filepath.Base(path) == DefaultsFile
+}
@@ -0,0 +1,174 @@
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaults(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html":         "page;{{ title }};{{ content|safe }}",
+		"includes/doc.html":          "doc;{{ title }};{{ content|safe }}",
+		"pages/_defaults.toml":       "title = \"Site\"\nauthor = \"Ann\"\n",
+		"pages/about.md":             "{{ 'about' }}",
+		"pages/docs/_defaults.toml":  "template = \"doc.html\"\ntitle = \"Docs\"\n",
+		"pages/docs/intro.md":        "intro",
+		"pages/docs/api/ref.md":      "---\ntitle: Reference\n---\nref",
+		"pages/docs/api/override.md": "---\ntemplate: page.html\n---\noverride",
+		"pages/legal/_defaults.toml": "templating = false\n",
+		"pages/legal/terms.md":       "{{ 'terms' }}",
+		"public/.keep":               "",
+	})
+
+	c := newTestSiteConfig()
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Path   string
+		Expect string
+	}{
+		{Path: "about.html", Expect: "page;Site;<p>about</p>"},
+		{Path: "docs/intro.html", Expect: "doc;Docs;<p>intro</p>"},
+		{Path: "docs/api/ref.html", Expect: "doc;Reference;<p>ref</p>"},
+		{Path: "docs/api/override.html", Expect: "page;Docs;<p>override</p>"},
+		{Path: "legal/terms.html", Expect: "page;Site;<p>{{ 'terms' }}</p>"},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Path, func(t *testing.T) {
+			fb, err := ioutil.ReadFile(filepath.Join(c.OutputDir, filepath.FromSlash(tcase.Path)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.TrimSpace(string(fb)); got != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, got)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(c.OutputDir, DefaultsFile)); !os.IsNotExist(err) {
+		t.Errorf("expected defaults file not to be written but got %v", err)
+	}
+}
+
+func TestDefaultLists(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html":        "{{ content|safe }}",
+		"pages/_defaults.toml":      "tags = [\"site\", \"news\"]\n",
+		"pages/about.md":            "about",
+		"pages/docs/_defaults.toml": "tags = [\"docs\"]\n",
+		"pages/docs/intro.md":       "intro",
+		"pages/docs/api.md":         "---\ntags: [api, go]\n---\napi",
+		"pages/docs/untagged.md":    "---\ntags: []\n---\nuntagged",
+		"public/.keep":              "",
+	})
+
+	b, err := New(newTestSiteConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Path   string
+		Expect string
+	}{
+		{Path: "pages/about.md", Expect: "site,news"},
+		{Path: "pages/docs/intro.md", Expect: "docs"},
+		{Path: "pages/docs/api.md", Expect: "api,go"},
+		{Path: "pages/docs/untagged.md", Expect: ""},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Path, func(t *testing.T) {
+			doc, err := b.parseMD(filepath.FromSlash(tcase.Path), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tags, ok := doc.frontMatter["tags"]
+			if !ok || tags != tcase.Expect {
+				t.Errorf("expected tags %q but got %q", tcase.Expect, tags)
+			}
+		})
+	}
+}
+
+func TestDefaultDates(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html": "{{ content|safe }}",
+		"pages/_defaults.toml": "date = 2021-01-02\n" +
+			"updated = 2021-01-02T03:04:05Z\n" +
+			"local = 2021-01-02T03:04:05\n",
+		"pages/about.md": "about",
+		"public/.keep":   "",
+	})
+
+	b, err := New(newTestSiteConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := b.parseMD(filepath.Join("pages", "about.md"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, expect := range map[string]string{
+		"date":    "2021-01-02",
+		"updated": "2021-01-02T03:04:05Z",
+		"local":   "2021-01-02T03:04:05",
+	} {
+		if got := doc.frontMatter[k]; got != expect {
+			t.Errorf("%s: expected %q but got %q", k, expect, got)
+		}
+	}
+}
+
+func TestDefaultTables(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html":   "{{ content|safe }}",
+		"pages/_defaults.toml": "[sitemap]\npriority = 0.5\n",
+		"pages/about.md":       "about",
+		"public/.keep":         "",
+	})
+
+	b, err := New(newTestSiteConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if !errors.Is(err, errNotSerializable) {
+		t.Fatalf("expected error %v but got %v", errNotSerializable, err)
+	}
+
+	expect := `could not process defaults "pages/_defaults.toml": not serializable: ` +
+		`key "sitemap" must be a string, number, boolean, date, or list of them`
+	if !strings.Contains(err.Error(), expect) {
+		t.Errorf("expected error to contain %q but got %q", expect, err)
+	}
+}
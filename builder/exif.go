@@ -0,0 +1,147 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+// exifOrientationTag is the EXIF tag that says how an image must be
+// rotated and flipped to be displayed upright.
+const exifOrientationTag = 0x0112
+
+// exifOrientation returns the EXIF orientation of the JPEG image in r, a
+// value from 1 to 8. It returns 1, which means no transformation, if the
+// image has no orientation or is not a JPEG image.
+func exifOrientation(r io.Reader) int {
+	var marker [2]byte
+
+	_, err := io.ReadFull(r, marker[:])
+	if err != nil || marker != [2]byte{0xff, 0xd8} {
+		return 1
+	}
+
+	// EXIF data is in an APP1 segment before the image data
+	for {
+		var head [4]byte
+
+		_, err := io.ReadFull(r, head[:])
+		if err != nil || head[0] != 0xff || head[1] == 0xda || head[1] == 0xd9 {
+			return 1
+		}
+
+		size := int64(binary.BigEndian.Uint16(head[2:])) - 2
+		if size < 0 {
+			return 1
+		}
+
+		if head[1] != 0xe1 {
+			_, err = io.CopyN(ioutil.Discard, r, size)
+			if err != nil {
+				return 1
+			}
+
+			continue
+		}
+
+		seg := make([]byte, size)
+
+		_, err = io.ReadFull(r, seg)
+		if err != nil {
+			return 1
+		}
+
+		if bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+	}
+}
+
+// tiffOrientation returns the orientation in the first IFD of the TIFF
+// structure of EXIF data, or 1 if there is none.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+
+			return o
+		}
+	}
+
+	return 1
+}
+
+// orient returns img rotated and flipped so that an image with the EXIF
+// orientation o is upright. Orientations 5 to 8 swap width and height.
+func orient(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+
+			switch o {
+			case 2: // flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotate by 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertically
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90° counterclockwise
+				sx, sy = w-1-y, x
+			}
+
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
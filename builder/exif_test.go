@@ -0,0 +1,131 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// jpegWithOrientation returns a JPEG image with an APP1 segment that holds
+// the EXIF orientation o in the given byte order.
+func jpegWithOrientation(t *testing.T, order binary.ByteOrder, o uint16) []byte {
+	img := new(bytes.Buffer)
+
+	err := jpeg.Encode(img, image.NewRGBA(image.Rect(0, 0, 2, 1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := new(bytes.Buffer)
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+
+	// Header, one IFD entry of type SHORT, and the offset of the next IFD
+	for _, v := range []interface{}{uint16(42), uint32(8), uint16(1),
+		uint16(exifOrientationTag), uint16(3), uint32(1), o, uint16(0), uint32(0)} {
+		err = binary.Write(tiff, order, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	out := new(bytes.Buffer)
+	out.Write(img.Bytes()[:2])
+	out.Write([]byte{0xff, 0xe1, byte((len(seg) + 2) >> 8), byte(len(seg) + 2)})
+	out.Write(seg)
+	out.Write(img.Bytes()[2:])
+
+	return out.Bytes()
+}
+
+func TestExifOrientation(t *testing.T) {
+	noExif := new(bytes.Buffer)
+
+	err := jpeg.Encode(noExif, image.NewRGBA(image.Rect(0, 0, 2, 1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pngImg := new(bytes.Buffer)
+
+	err = png.Encode(pngImg, image.NewRGBA(image.Rect(0, 0, 2, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name   string
+		Image  []byte
+		Expect int
+	}{
+		{Name: "little endian", Image: jpegWithOrientation(t, binary.LittleEndian, 6), Expect: 6},
+		{Name: "big endian", Image: jpegWithOrientation(t, binary.BigEndian, 3), Expect: 3},
+		{Name: "invalid orientation", Image: jpegWithOrientation(t, binary.BigEndian, 9), Expect: 1},
+		{Name: "no exif", Image: noExif.Bytes(), Expect: 1},
+		{Name: "png", Image: pngImg.Bytes(), Expect: 1},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			if o := exifOrientation(bytes.NewReader(tcase.Image)); o != tcase.Expect {
+				t.Errorf("expected %d but got %d", tcase.Expect, o)
+			}
+
+			if _, _, err := image.Decode(bytes.NewReader(tcase.Image)); err != nil {
+				t.Errorf("could not decode image: %v", err)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// Each pixel of the 3x2 source holds its coordinates
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+
+	tests := []struct {
+		Orientation int
+		Size        image.Point
+		// Expect holds the source coordinates of the first two pixels of
+		// the first row
+		Expect [2]image.Point
+	}{
+		{Orientation: 1, Size: image.Pt(3, 2), Expect: [2]image.Point{{0, 0}, {1, 0}}},
+		{Orientation: 2, Size: image.Pt(3, 2), Expect: [2]image.Point{{2, 0}, {1, 0}}},
+		{Orientation: 3, Size: image.Pt(3, 2), Expect: [2]image.Point{{2, 1}, {1, 1}}},
+		{Orientation: 4, Size: image.Pt(3, 2), Expect: [2]image.Point{{0, 1}, {1, 1}}},
+		{Orientation: 5, Size: image.Pt(2, 3), Expect: [2]image.Point{{0, 0}, {0, 1}}},
+		{Orientation: 6, Size: image.Pt(2, 3), Expect: [2]image.Point{{0, 1}, {0, 0}}},
+		{Orientation: 7, Size: image.Pt(2, 3), Expect: [2]image.Point{{2, 1}, {2, 0}}},
+		{Orientation: 8, Size: image.Pt(2, 3), Expect: [2]image.Point{{2, 0}, {2, 1}}},
+	}
+
+	for _, tcase := range tests {
+		dst := orient(src, tcase.Orientation)
+
+		if size := dst.Bounds().Size(); size != tcase.Size {
+			t.Errorf("orientation %d: expected size %v but got %v", tcase.Orientation, tcase.Size, size)
+			continue
+		}
+
+		for x, e := range tcase.Expect {
+			r, g, _, _ := dst.At(x, 0).RGBA()
+			if got := image.Pt(int(r>>8), int(g>>8)); got != e {
+				t.Errorf("orientation %d: expected pixel %d from %v but got %v", tcase.Orientation, x, e, got)
+			}
+		}
+	}
+}
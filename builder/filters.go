@@ -0,0 +1,446 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+var (
+	errFilterInput = errors.New("invalid filter input")
+	errFilterParam = errors.New("invalid filter parameter")
+)
+
+// wordsPerMinute is the reading speed used by the readingtime filter by
+// default.
+const wordsPerMinute = 200
+
+// htmlTokenRegexp matches HTML tags and comments.
+var htmlTokenRegexp = regexp.MustCompile(`<!--[\s\S]*?-->|</?[a-zA-Z][a-zA-Z0-9-]*[^>]*>`)
+
+// Group is a group of items with the same key made by the groupby filter.
+type Group struct {
+	Key   interface{}
+	Items []interface{}
+}
+
+// filterError returns the pongo2 error of the filter name.
+func filterError(name string, err error) *pongo2.Error {
+	return &pongo2.Error{Sender: "filter:" + name, OrigError: err}
+}
+
+// builtinFilters returns the template filters of the Builder. HTML is
+// truncated with the truncatewords_html filter built into pongo2.
+func (b *Builder) builtinFilters() map[string]pongo2.FilterFunction {
+	return map[string]pongo2.FilterFunction{
+		"key":          b.filterKey,
+		"asset":        b.filterAsset,
+		"integrity":    b.filterIntegrity,
+		"absurl":       b.filterAbsURL,
+		"relurl":       b.filterRelURL,
+		"markdownify":  b.filterMarkdownify,
+		"slugify":      filterSlugify,
+		"readingtime":  filterReadingTime,
+		"jsonify":      filterJSONify,
+		"where":        filterWhere,
+		"sortby":       filterSortBy,
+		"groupby":      filterGroupBy,
+		"date_rfc3339": filterDateRFC3339,
+	}
+}
+
+// filterKey looks up the asset key param in the asset map in. In strict
+// mode, unknown keys are problems of the build instead of empty strings.
+func (b *Builder) filterKey(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	m, ok := in.Interface().(map[string]string)
+	if !ok {
+		return nil, filterError("key", fmt.Errorf("%w: expected an asset map such as %q but got %T",
+			errFilterInput, "assets", in.Interface()))
+	}
+
+	val, ok := m[param.String()]
+	if !ok && b.config.Strict {
+		b.addProblem(fmt.Errorf("%w: %q", errUnknownAsset, param.String()))
+	}
+
+	return pongo2.AsValue(val), nil
+}
+
+// filterAsset returns the URL of the public asset with the key in. Unknown
+// keys are errors, or problems of the build in strict mode.
+func (b *Builder) filterAsset(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	val, ok := b.assets[in.String()]
+	if !ok {
+		err := fmt.Errorf("%w: %q is not a file in %q", errUnknownAsset, in.String(), b.config.PublicDir)
+		if !b.config.Strict {
+			return nil, filterError("asset", err)
+		}
+
+		b.addProblem(err)
+	}
+
+	return pongo2.AsValue(val), nil
+}
+
+// filterIntegrity returns the integrity attribute of the public asset with
+// the key in. In strict mode, unknown keys are problems of the build.
+func (b *Builder) filterIntegrity(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	val, ok := b.integrity[in.String()]
+	if !ok {
+		if b.config.Strict {
+			b.addProblem(fmt.Errorf("%w: %q", errUnknownAsset, in.String()))
+		}
+
+		return pongo2.AsValue(""), nil
+	}
+
+	return pongo2.AsSafeValue(fmt.Sprintf("integrity=%q", val)), nil
+}
+
+// filterAbsURL returns the absolute URL of the path in on the site.
+// Absolute URLs are returned unchanged.
+func (b *Builder) filterAbsURL(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	s := in.String()
+
+	if u, err := url.Parse(s); err == nil && u.IsAbs() {
+		return pongo2.AsValue(s), nil
+	}
+
+	return pongo2.AsValue(strings.TrimSuffix(b.config.SiteURL, "/") + "/" + strings.TrimPrefix(s, "/")), nil
+}
+
+// filterRelURL returns the URL of the path in relative to the host of the
+// site, including the path of the site URL. Absolute URLs on the site are
+// made relative and other absolute URLs are returned unchanged.
+func (b *Builder) filterRelURL(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	s := in.String()
+
+	site, err := url.Parse(b.config.SiteURL)
+	if err != nil {
+		return nil, filterError("relurl", fmt.Errorf("could not parse site url: %w", err))
+	}
+
+	if u, err := url.Parse(s); err == nil && u.IsAbs() {
+		if u.Host != site.Host {
+			return pongo2.AsValue(s), nil
+		}
+
+		u.Scheme, u.Host, u.User = "", "", nil
+
+		return pongo2.AsValue(u.String()), nil
+	}
+
+	return pongo2.AsValue(strings.TrimSuffix(site.Path, "/") + "/" + strings.TrimPrefix(s, "/")), nil
+}
+
+// filterMarkdownify renders the markdown in as HTML.
+func (b *Builder) filterMarkdownify(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	buf := new(bytes.Buffer)
+
+	err := b.markdown.Convert([]byte(in.String()), buf)
+	if err != nil {
+		return nil, filterError("markdownify", err)
+	}
+
+	s := replaceShortcodes(buf.String(), b.takeCodeBlocks())
+	if b.policy != nil {
+		s = b.policy.Sanitize(s)
+	}
+
+	return pongo2.AsSafeValue(s), nil
+}
+
+// filterSlugify returns in in lower case with runs of characters that are
+// not letters or digits replaced by a dash.
+func filterSlugify(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	var sb strings.Builder
+
+	dash := false
+	for _, r := range strings.ToLower(in.String()) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return pongo2.AsValue(sb.String()), nil
+}
+
+// filterReadingTime returns the number of minutes it takes to read the text
+// or HTML in at param words per minute, or 200 if param is not given.
+func filterReadingTime(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	wpm := wordsPerMinute
+	if !param.IsNil() {
+		wpm = param.Integer()
+		if wpm <= 0 {
+			return nil, filterError("readingtime", fmt.Errorf("%w: %q must be greater than 0",
+				errFilterParam, param.String()))
+		}
+	}
+
+	words := len(strings.Fields(htmlTokenRegexp.ReplaceAllString(in.String(), " ")))
+	minutes := int(math.Ceil(float64(words) / float64(wpm)))
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	return pongo2.AsValue(minutes), nil
+}
+
+// filterJSONify returns in encoded as JSON, indented by param spaces if
+// param is given.
+func filterJSONify(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	var (
+		fb  []byte
+		err error
+	)
+
+	if param.IsNil() {
+		fb, err = json.Marshal(in.Interface())
+	} else {
+		indent := param.Integer()
+		if indent < 0 {
+			return nil, filterError("jsonify", fmt.Errorf("%w: %q must not be negative",
+				errFilterParam, param.String()))
+		}
+
+		fb, err = json.MarshalIndent(in.Interface(), "", strings.Repeat(" ", indent))
+	}
+	if err != nil {
+		return nil, filterError("jsonify", err)
+	}
+
+	return pongo2.AsSafeValue(string(fb)), nil
+}
+
+// filterWhere returns the items of the list in whose field matches param.
+// A param of "field=value" matches items whose field equals value, and a
+// param of "field" matches items whose field is true.
+func filterWhere(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	items, err := listOf(in)
+	if err != nil {
+		return nil, filterError("where", err)
+	}
+
+	field, want := param.String(), "true"
+	if i := strings.Index(field, "="); i >= 0 {
+		field, want = field[:i], field[i+1:]
+	}
+
+	if field == "" {
+		return nil, filterError("where", fmt.Errorf("%w: %q", errFilterParam, param.String()))
+	}
+
+	matches := make([]interface{}, 0)
+	for _, item := range items {
+		if val, ok := lookupField(item, field); ok && fmt.Sprint(val) == want {
+			matches = append(matches, item)
+		}
+	}
+
+	return pongo2.AsValue(matches), nil
+}
+
+// filterSortBy returns the list in sorted by the field param. Fields that
+// start with "-" are sorted in descending order. Items without the field
+// come last.
+func filterSortBy(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	items, err := listOf(in)
+	if err != nil {
+		return nil, filterError("sortby", err)
+	}
+
+	field := param.String()
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+
+	if field == "" {
+		return nil, filterError("sortby", fmt.Errorf("%w: %q", errFilterParam, param.String()))
+	}
+
+	sorted := make([]interface{}, len(items))
+	copy(sorted, items)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, aok := lookupField(sorted[i], field)
+		b, bok := lookupField(sorted[j], field)
+		if !aok || !bok {
+			return aok && !bok
+		}
+
+		if desc {
+			return lessValue(b, a)
+		}
+
+		return lessValue(a, b)
+	})
+
+	return pongo2.AsValue(sorted), nil
+}
+
+// filterGroupBy groups the items of the list in by the field param. Groups
+// are in the order their keys first appear. Items without the field are
+// left out.
+func filterGroupBy(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	items, err := listOf(in)
+	if err != nil {
+		return nil, filterError("groupby", err)
+	}
+
+	groups := make([]*Group, 0)
+	index := make(map[interface{}]*Group)
+
+	for _, item := range items {
+		key, ok := lookupField(item, param.String())
+		if !ok {
+			continue
+		}
+
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			key = fmt.Sprint(key)
+		}
+
+		g, ok := index[key]
+		if !ok {
+			g = &Group{Key: key}
+			index[key] = g
+			groups = append(groups, g)
+		}
+
+		g.Items = append(g.Items, item)
+	}
+
+	return pongo2.AsValue(groups), nil
+}
+
+// filterDateRFC3339 formats the time in as RFC 3339.
+func filterDateRFC3339(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	switch t := in.Interface().(type) {
+	case time.Time:
+		return pongo2.AsValue(t.Format(time.RFC3339)), nil
+	case *time.Time:
+		return pongo2.AsValue(t.Format(time.RFC3339)), nil
+	default:
+		return nil, filterError("date_rfc3339", fmt.Errorf("%w: expected a time but got %T",
+			errFilterInput, in.Interface()))
+	}
+}
+
+// listOf returns the items of the list in.
+func listOf(in *pongo2.Value) ([]interface{}, error) {
+	rv := reflect.ValueOf(in.Interface())
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%w: expected a list but got %T", errFilterInput, in.Interface())
+	}
+
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+
+	return items, nil
+}
+
+// lookupField returns the value at the dotted path of fields, map keys, and
+// methods without arguments in v, such as "Date.Year" for posts.
+func lookupField(v interface{}, path string) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+
+	for _, name := range strings.Split(path, ".") {
+		for rv.Kind() == reflect.Interface && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+
+		// Methods can't be called on nil pointers and interfaces
+		if !rv.IsValid() || (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil() {
+			return nil, false
+		}
+
+		if m := rv.MethodByName(name); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+			rv = m.Call(nil)[0]
+			continue
+		}
+
+		if rv.Kind() == reflect.Ptr {
+			rv = rv.Elem()
+		}
+
+		switch rv.Kind() {
+		case reflect.Struct:
+			f, ok := rv.Type().FieldByName(name)
+			if !ok || f.PkgPath != "" {
+				return nil, false
+			}
+
+			rv = rv.FieldByIndex(f.Index)
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+
+			rv = rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+			if !rv.IsValid() {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+
+	if !rv.IsValid() || !rv.CanInterface() {
+		return nil, false
+	}
+
+	return rv.Interface(), true
+}
+
+// lessValue reports whether a sorts before b. Times and numbers are
+// compared by value and everything else by its string form.
+func lessValue(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		if bt, ok := b.(time.Time); ok {
+			return at.Before(bt)
+		}
+	}
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		return af < bf
+	}
+
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// toFloat returns the number v as a float64.
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,172 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flosch/pongo2/v4"
+	"github.com/yuin/goldmark"
+)
+
+func TestFilters(t *testing.T) {
+	b := &Builder{
+		config: &Config{
+			SiteURL:   "https://example.com/blog/",
+			PublicDir: "public",
+		},
+		markdown: goldmark.New(),
+		assets:   map[string]string{"styles.css": "/styles.abc.css"},
+	}
+
+	err := b.initTemplateFuncs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.templates = pongo2.NewSet("test", pongo2.MustNewLocalFileSystemLoader(t.TempDir()))
+
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return d
+	}
+
+	posts := []*Post{
+		{Title: "B", Date: date("2020-05-01"), frontMatter: map[string]string{"draft": "true"}},
+		{Title: "A", Date: date("2021-01-01"), frontMatter: map[string]string{}},
+		{Title: "C", Date: date("2020-01-01"), frontMatter: map[string]string{"draft": "false"}},
+	}
+
+	tests := []struct {
+		Name   string
+		Tpl    string
+		Ctx    pongo2.Context
+		Expect string
+		Err    error
+	}{
+		{
+			Name:   "key",
+			Tpl:    "{{ assets|key:'styles.css' }}",
+			Ctx:    pongo2.Context{"assets": b.assets},
+			Expect: "/styles.abc.css",
+		},
+		{
+			Name: "key without asset map",
+			Tpl:  "{{ 'styles.css'|key:'styles.css' }}",
+			Err:  errFilterInput,
+		},
+		{
+			Name:   "asset",
+			Tpl:    "{{ 'styles.css'|asset }}",
+			Expect: "/styles.abc.css",
+		},
+		{
+			Name: "unknown asset",
+			Tpl:  "{{ 'missing.css'|asset }}",
+			Err:  errUnknownAsset,
+		},
+		{
+			Name:   "absurl",
+			Tpl:    "{{ '/posts/a.html'|absurl }} {{ 'https://other.com/'|absurl }}",
+			Expect: "https://example.com/blog/posts/a.html https://other.com/",
+		},
+		{
+			Name:   "relurl",
+			Tpl:    "{{ 'posts/a.html'|relurl }} {{ 'https://example.com/x?y=1'|relurl }} {{ 'https://other.com/'|relurl }}",
+			Expect: "/blog/posts/a.html /x?y=1 https://other.com/",
+		},
+		{
+			Name:   "slugify",
+			Tpl:    "{{ '  Hello, Wörld! 2021 '|slugify }}",
+			Expect: "hello-wörld-2021",
+		},
+		{
+			Name:   "markdownify",
+			Tpl:    "{{ '**bold**'|markdownify }}",
+			Expect: "<p><strong>bold</strong></p>\n",
+		},
+		{
+			Name:   "readingtime",
+			Ctx:    pongo2.Context{"text": "<p>word</p> word word word"},
+			Tpl:    "{{ text|readingtime }} {{ text|readingtime:2 }}",
+			Expect: "1 2",
+		},
+		{
+			Name:   "jsonify",
+			Ctx:    pongo2.Context{"data": map[string]interface{}{"a": []int{1, 2}}},
+			Tpl:    "{{ data|jsonify }}",
+			Expect: `{"a":[1,2]}`,
+		},
+		{
+			Name: "jsonify with negative indent",
+			Ctx:  pongo2.Context{"data": []int{1}, "n": -1},
+			Tpl:  "{{ data|jsonify:n }}",
+			Err:  errFilterParam,
+		},
+		{
+			Name:   "where",
+			Ctx:    pongo2.Context{"posts": posts},
+			Tpl:    "{% for p in posts|where:'FrontMatter.draft=false' %}{{ p.Title }}{% endfor %}",
+			Expect: "C",
+		},
+		{
+			Name:   "where on data",
+			Ctx:    pongo2.Context{"items": []interface{}{map[string]interface{}{"n": 1, "ok": true}, map[string]interface{}{"n": 2}}},
+			Tpl:    "{% for i in items|where:'ok' %}{{ i.n }}{% endfor %}",
+			Expect: "1",
+		},
+		{
+			Name:   "sortby",
+			Ctx:    pongo2.Context{"posts": posts},
+			Tpl:    "{% for p in posts|sortby:'Title' %}{{ p.Title }}{% endfor %} {% for p in posts|sortby:'-Date' %}{{ p.Title }}{% endfor %}",
+			Expect: "ABC ABC",
+		},
+		{
+			Name:   "groupby",
+			Ctx:    pongo2.Context{"posts": posts},
+			Tpl:    "{% for g in posts|groupby:'Date.Year' %}{{ g.Key }}:{% for p in g.Items %}{{ p.Title }}{% endfor %};{% endfor %}",
+			Expect: "2020:BC;2021:A;",
+		},
+		{
+			Name:   "nil items",
+			Ctx:    pongo2.Context{"posts": []*Post{posts[0], nil}, "items": []interface{}{nil, map[string]interface{}{"n": 1}}},
+			Tpl:    "{{ posts|where:'FrontMatter.draft=true'|length }}{{ posts|sortby:'Date.Year'|length }}{{ items|groupby:'n'|length }}",
+			Expect: "121",
+		},
+		{
+			Name: "sortby on non-list",
+			Tpl:  "{{ 'abc'|sortby:'Title' }}",
+			Err:  errFilterInput,
+		},
+		{
+			Name:   "date_rfc3339",
+			Ctx:    pongo2.Context{"date": date("2021-02-03")},
+			Tpl:    "{{ date|date_rfc3339 }}",
+			Expect: "2021-02-03T00:00:00Z",
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tpl, err := b.fromString(tcase.Tpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// pongo2 errors do not wrap the errors of filters
+			s, err := b.execute(tpl, tcase.Ctx)
+			if (err == nil) != (tcase.Err == nil) ||
+				err != nil && !strings.Contains(err.Error(), tcase.Err.Error()) {
+				t.Fatalf("expected error %v but got %v", tcase.Err, err)
+			}
+
+			if s != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, s)
+			}
+		})
+	}
+}
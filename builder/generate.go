@@ -0,0 +1,180 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+var (
+	errNoSlug        = errors.New(`pages with a "generate" directive need a "slug" directive`)
+	errInvalidSlug   = errors.New("invalid slug")
+	errDuplicateSlug = errors.New("duplicate slug")
+	errSlugCollision = errors.New("slug collides with another page")
+	errDataNotFound  = errors.New("data not found")
+	errNotList       = errors.New("data is not a list")
+)
+
+// generatePages writes a page for every item of the data list named by the
+// "generate" front-matter directive of the markdown page at path. The item
+// is available as "item" in the page, its template, and its "slug",
+// "title", and "description" directives. Pages are written to the output
+// dir of path and are named by their slugs.
+func (b *Builder) generatePages(path string, doc *mdDoc, publicAssets map[string]string) error {
+	items, err := b.lookupData(doc.frontMatter["generate"])
+	if err != nil {
+		return fmt.Errorf("could not generate pages from %q: %w", path, err)
+	}
+
+	slugS, ok := doc.frontMatter["slug"]
+	if !ok {
+		return fmt.Errorf("%w: %q", errNoSlug, path)
+	}
+
+	// The slug, title, and description directives are templates
+	metaTpls := make(map[string]*pongo2.Template)
+	for _, k := range []string{"slug", "title", "description"} {
+		dat, ok := doc.frontMatter[k]
+		if !ok {
+			continue
+		}
+
+		metaTpls[k], err = b.fromString(dat)
+		if err != nil {
+			return fmt.Errorf("could not compile %q directive %q: %w", k, dat, err)
+		}
+	}
+
+	tpl, err := b.resolveTplFromFM(b.config.DefaultPageTemplate, doc.frontMatter)
+	if err != nil {
+		return fmt.Errorf("could not get page template for %q: %w", path, err)
+	}
+
+	dir := filepath.Dir(b.mdPageOutPath(path))
+	slugs := make(map[string]bool)
+
+	for _, item := range items {
+		p2ctx := pongo2.Context{"assets": publicAssets, "item": item}
+
+		// Render the directives that depend on the item
+		frontMatter := make(map[string]string, len(doc.frontMatter))
+		for k, v := range doc.frontMatter {
+			frontMatter[k] = v
+		}
+
+		for k, t := range metaTpls {
+			frontMatter[k], err = b.execute(t, p2ctx)
+			if err != nil {
+				return fmt.Errorf("could not render %q directive: %w", k, err)
+			}
+		}
+
+		slug := strings.TrimSpace(frontMatter["slug"])
+		if slug == "" || slug == "." || slug == ".." || strings.ContainsAny(slug, `/\`) {
+			return fmt.Errorf("%w: %q rendered from %q", errInvalidSlug, slug, slugS)
+		}
+
+		if slugs[slug] {
+			return fmt.Errorf("%w: %q", errDuplicateSlug, slug)
+		}
+
+		slugs[slug] = true
+
+		outP := filepath.Join(dir, slug+".html")
+		if src, ok := b.outputSource(path, outP); ok {
+			return fmt.Errorf("%w: %q is also written by %q", errSlugCollision, outP, src)
+		}
+
+		b.generated[outP] = path
+
+		mdS, err := doc.execute(p2ctx)
+		if err != nil {
+			return fmt.Errorf("error rendering markdown for %q: %w", slug, err)
+		}
+
+		pageTitle, title, desc := b.getPageMeta(frontMatter)
+
+		err = b.writeTpl(tpl, outP, pongo2.Context{
+			"pageTitle":       pageTitle,
+			"pageDescription": desc,
+			"siteURL":         b.config.SiteURL,
+			"assets":          publicAssets,
+			"title":           title,
+			"content":         mdS,
+			"item":            item,
+		})
+		if err != nil {
+			return fmt.Errorf("error writing generated page %q: %w", outP, err)
+		}
+	}
+
+	return nil
+}
+
+// outputSource returns the source of a page other than path that is
+// written to outP, if any. This is a page generated earlier in the build,
+// a page in the pages dir, or a post.
+func (b *Builder) outputSource(path, outP string) (string, bool) {
+	if src, ok := b.generated[outP]; ok {
+		return src, true
+	}
+
+	rel := strings.TrimSuffix(relPath(b.config.OutputDir, outP), ".html")
+
+	candidates := []string{
+		filepath.Join(b.config.PagesDir, rel+".md"),
+		filepath.Join(b.config.PagesDir, rel+".html"),
+	}
+
+	if b.config.PostsDir != "" {
+		postsRel, err := filepath.Rel(filepath.Base(b.config.PostsDir), rel)
+		if err == nil && !strings.HasPrefix(postsRel, "..") {
+			candidates = append(candidates, filepath.Join(b.config.PostsDir, postsRel+".md"))
+		}
+	}
+
+	for _, src := range candidates {
+		if filepath.Clean(src) == filepath.Clean(path) {
+			continue
+		}
+
+		if info, err := os.Stat(src); err == nil && !info.IsDir() {
+			return src, true
+		}
+	}
+
+	return "", false
+}
+
+// lookupData returns the list at the dotted path expr in the data of the
+// build, such as "data.products".
+func (b *Builder) lookupData(expr string) ([]interface{}, error) {
+	keys := strings.Split(strings.TrimSpace(expr), ".")
+	if keys[0] != "data" {
+		return nil, fmt.Errorf("%w: %q must start with %q", errDataNotFound, expr, "data.")
+	}
+
+	var val interface{} = b.data
+	for _, k := range keys[1:] {
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errDataNotFound, expr)
+		}
+
+		val, ok = m[k]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errDataNotFound, expr)
+		}
+	}
+
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errNotList, expr)
+	}
+
+	return list, nil
+}
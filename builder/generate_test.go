@@ -0,0 +1,185 @@
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePages(t *testing.T) {
+	products := `
+- id: widget
+  name: Widget
+  price: 3
+- id: gadget
+  name: Gadget
+  price: 5
+`
+
+	tests := []struct {
+		Name    string
+		Page    string
+		Data    string
+		Files   map[string]string
+		Expect  map[string]string
+		WantErr error
+	}{
+		{
+			Name: "page per item",
+			Page: `---
+generate: data.products
+slug: "{{ item.id }}"
+title: "{{ item.name }}"
+---
+Costs {{ item.price }} dollars.
+`,
+			Data: products,
+			Expect: map[string]string{
+				"build/products/widget.html": "Test | Widget;Widget;<p>Costs 3 dollars.</p>",
+				"build/products/gadget.html": "Test | Gadget;Gadget;<p>Costs 5 dollars.</p>",
+			},
+		},
+		{
+			Name: "missing slug",
+			Page: `---
+generate: data.products
+---
+`,
+			Data:    products,
+			WantErr: errNoSlug,
+		},
+		{
+			Name: "duplicate slug",
+			Page: `---
+generate: data.products
+slug: same
+---
+`,
+			Data:    products,
+			WantErr: errDuplicateSlug,
+		},
+		{
+			Name: "slug of index page",
+			Page: `---
+generate: data.products
+slug: "{% if item.id == 'widget' %}index{% else %}{{ item.id }}{% endif %}"
+---
+`,
+			Data:    products,
+			Files:   map[string]string{"pages/products/index.md": "Products"},
+			WantErr: errSlugCollision,
+		},
+		{
+			Name: "slug of existing page",
+			Page: `---
+generate: data.products
+slug: "{{ item.id }}"
+---
+`,
+			Data:    products,
+			Files:   map[string]string{"pages/products/gadget.html": "Gadget"},
+			WantErr: errSlugCollision,
+		},
+		{
+			Name: "invalid slug",
+			Page: `---
+generate: data.products
+slug: "{{ item.missing }}"
+---
+`,
+			Data:    products,
+			WantErr: errInvalidSlug,
+		},
+		{
+			Name: "missing data",
+			Page: `---
+generate: data.missing
+slug: "{{ item.id }}"
+---
+`,
+			Data:    products,
+			WantErr: errDataNotFound,
+		},
+		{
+			Name: "not a list",
+			Page: `---
+generate: data.products
+slug: "{{ item.id }}"
+---
+`,
+			Data:    "widget: Widget\n",
+			WantErr: errNotList,
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			files := map[string]string{
+				"includes/page.html":        "{{ pageTitle }};{{ title }};{{ content|safe }}",
+				"pages/products/product.md": tcase.Page,
+				"public/.keep":              "",
+				"data/products.yaml":        tcase.Data,
+			}
+			for name, content := range tcase.Files {
+				files[name] = content
+			}
+
+			chdirSite(t, files)
+
+			c := newTestSiteConfig()
+			c.DataDir = "data"
+
+			b, err := New(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if !errors.Is(err, tcase.WantErr) {
+				t.Fatalf("expected error %v but got %v", tcase.WantErr, err)
+			}
+
+			for p, expect := range tcase.Expect {
+				fb, err := ioutil.ReadFile(filepath.FromSlash(p))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := strings.TrimSpace(string(fb)); got != expect {
+					t.Errorf("%s: expected %q but got %q", p, expect, got)
+				}
+			}
+
+			if _, err := os.Stat(filepath.Join("build", "products", "product.html")); !os.IsNotExist(err) {
+				t.Errorf("expected generating page not to be written but got %v", err)
+			}
+		})
+	}
+}
+
+func TestLinkToGeneratingPage(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html":        "{{ content|safe }}",
+		"pages/about.md":            "[Products](products/product.md)",
+		"pages/products/product.md": "---\ngenerate: data.products\nslug: \"{{ item.id }}\"\n---\n",
+		"public/.keep":              "",
+		"data/products.yaml":        "- id: widget\n",
+	})
+
+	c := newTestSiteConfig()
+	c.DataDir = "data"
+	c.BrokenLinks = BrokenLinksError
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if !errors.Is(err, errGeneratorLink) {
+		t.Fatalf("expected error %v but got %v", errGeneratorLink, err)
+	}
+}
@@ -0,0 +1,58 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// chdirSite writes files to a temporary dir and changes the working dir to
+// it for the duration of the test.
+func chdirSite(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(p), 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(p, []byte(content), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err := os.Chdir(wd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func newTestSiteConfig() *Config {
+	return &Config{
+		SiteTitle:           "Test",
+		SiteURL:             "http://localhost",
+		TemplatesDir:        "includes",
+		PagesDir:            "pages",
+		PublicDir:           "public",
+		OutputDir:           "build",
+		DefaultPageTemplate: "page.html",
+		NoMinify:            true,
+	}
+}
@@ -0,0 +1,104 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Environment variables that are set for hook commands.
+const (
+	// EnvOutputDir is the absolute path of the output dir.
+	EnvOutputDir = "YAGSS_OUTPUT_DIR"
+	// EnvChangedFiles is the newline separated list of files whose change
+	// caused the build. It is empty for full builds.
+	EnvChangedFiles = "YAGSS_CHANGED_FILES"
+	// EnvFile is the path of the file being transformed by a transform
+	// command.
+	EnvFile = "YAGSS_FILE"
+)
+
+// TransformCommand configures a shell command that transforms files in the
+// public dir. The command reads the content of a file from stdin and writes
+// the transformed content to stdout.
+type TransformCommand struct {
+	// Pattern is a glob pattern that keys must match to be transformed.
+	// Patterns without a slash are matched against file names.
+	Pattern string
+	// Command is the shell command.
+	Command string
+}
+
+// commandTransformer is a Transformer that pipes files through a shell
+// command.
+type commandTransformer struct {
+	globMatcher
+	command string
+	env     func() []string
+}
+
+func (t *commandTransformer) Transform(path string, content []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := shellCommand(t.command)
+	cmd.Env = append(t.env(), EnvFile+"="+path)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("command %q failed: %w: %s", t.command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// runHook runs the hook command. Its output is written to the log of the
+// Builder.
+func (b *Builder) runHook(name, command string) error {
+	if command == "" {
+		return nil
+	}
+
+	b.log.Printf("==> Running %s hook %q", name, command)
+
+	cmd := shellCommand(command)
+	cmd.Env = b.hookEnv()
+	cmd.Stdout = b.log.Writer()
+	cmd.Stderr = b.log.Writer()
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s hook %q failed: %w", name, command, err)
+	}
+
+	return nil
+}
+
+// hookEnv returns the environment of hook commands.
+func (b *Builder) hookEnv() []string {
+	outDir, err := filepath.Abs(b.config.OutputDir)
+	if err != nil {
+		outDir = b.config.OutputDir
+	}
+
+	return append(os.Environ(),
+		EnvOutputDir+"="+outDir,
+		EnvChangedFiles+"="+strings.Join(b.changed, "\n"),
+	)
+}
+
+// shellCommand returns a command that runs command with the shell of the
+// operating system.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+
+	return exec.Command("sh", "-c", command)
+}
@@ -0,0 +1,121 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test need a POSIX shell")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir("../example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err := os.Chdir(wd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("commands", func(t *testing.T) {
+		c, err := ReadConfig(ConfigFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.OutputDir = t.TempDir()
+		c.HashExts = nil
+		c.NoMinify = true
+		c.PreBuildCommand = `test -d "$YAGSS_OUTPUT_DIR"`
+		c.PostBuildCommand = `printf '%s' "$YAGSS_CHANGED_FILES" > "$YAGSS_OUTPUT_DIR/changed.txt"`
+		c.TransformCommands = []TransformCommand{
+			{Pattern: "*.css", Command: `tr a-z A-Z; printf '/* %s */' "$YAGSS_FILE"`},
+		}
+
+		b, err := New(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.BuildChanged([]string{"pages/index.html", "public/styles.css"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		changed, err := ioutil.ReadFile(filepath.Join(c.OutputDir, "changed.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(changed) != "pages/index.html\npublic/styles.css" {
+			t.Errorf("expected changed files to be passed to hook but got %q", changed)
+		}
+
+		css, err := ioutil.ReadFile(filepath.Join(c.OutputDir, "styles.css"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(css), "BODY") || !strings.Contains(string(css), "/* public/styles.css */") {
+			t.Errorf("expected styles.css to be transformed but got %q", css)
+		}
+	})
+
+	for _, tcase := range []struct {
+		Name   string
+		Config func(c *Config)
+		Expect string
+	}{
+		{
+			Name:   "failed pre build",
+			Config: func(c *Config) { c.PreBuildCommand = "exit 3" },
+			Expect: `preBuild hook "exit 3" failed`,
+		},
+		{
+			Name:   "failed post build",
+			Config: func(c *Config) { c.PostBuildCommand = "exit 1" },
+			Expect: `postBuild hook "exit 1" failed`,
+		},
+		{
+			Name: "failed transform",
+			Config: func(c *Config) {
+				c.TransformCommands = []TransformCommand{{Pattern: "*.css", Command: "echo oops >&2; exit 1"}}
+			},
+			Expect: "oops",
+		},
+	} {
+		t.Run(tcase.Name, func(t *testing.T) {
+			c, err := ReadConfig(ConfigFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c.OutputDir = t.TempDir()
+			tcase.Config(c)
+
+			b, err := New(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if err == nil || !strings.Contains(err.Error(), tcase.Expect) {
+				t.Errorf("expected error containing %q but got %v", tcase.Expect, err)
+			}
+		})
+	}
+}
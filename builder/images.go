@@ -0,0 +1,567 @@
+package builder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+var errUnsupportedImage = errors.New("unsupported image format")
+
+// assetsKey holds the public assets of the current build while markdown
+// is parsed.
+var assetsKey = parser.NewContextKey()
+
+// imageVariant is a resized version of an image in the output dir.
+type imageVariant struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+// imageProcessor resizes images from the public dir. Resized images are
+// cached between builds in the cache dir, if one is configured.
+type imageProcessor struct {
+	b *Builder
+	// written holds the output paths written during the current build
+	written map[string]bool
+	// dims caches the dimensions of images in the public dir
+	dims map[string][2]int
+}
+
+func newImageProcessor(b *Builder) *imageProcessor {
+	p := &imageProcessor{b: b}
+	p.reset()
+
+	return p
+}
+
+// reset must be called at the start of every build.
+func (p *imageProcessor) reset() {
+	p.written = make(map[string]bool)
+	p.dims = make(map[string][2]int)
+}
+
+// process resizes the image at src, which is a path relative to the public
+// dir, to the given widths and returns the variants ordered by width.
+// Images are never scaled up. If no width is smaller than the original
+// width, a single variant with the original width is returned.
+func (p *imageProcessor) process(src string, widths []int) ([]imageVariant, error) {
+	srcP := filepath.Join(p.b.config.PublicDir, filepath.FromSlash(src))
+
+	fb, err := ioutil.ReadFile(srcP)
+	if err != nil {
+		return nil, fmt.Errorf("could not read image %q: %w", srcP, err)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(fb))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image %q: %w", srcP, err)
+	}
+
+	if format != "jpeg" && format != "png" {
+		return nil, fmt.Errorf("%w: %q", errUnsupportedImage, srcP)
+	}
+
+	// Resized images have no EXIF data, so they are rotated upright
+	orientation := exifOrientation(bytes.NewReader(fb))
+	if orientation >= 5 {
+		cfg.Width, cfg.Height = cfg.Height, cfg.Width
+	}
+
+	sum := sha256.Sum256(fb)
+	hashS := hex.EncodeToString(sum[:])
+
+	var (
+		variants []imageVariant
+		img      image.Image
+	)
+
+	for _, w := range fitWidths(widths, cfg.Width) {
+		h := (cfg.Height*w + cfg.Width/2) / cfg.Width
+		if h < 1 {
+			h = 1
+		}
+
+		// The output file is placed next to where the original would be
+		ext := filepath.Ext(src)
+		name := fmt.Sprintf("%s.%dw.%s%s", strings.TrimSuffix(filepath.Base(src), ext), w, hashS[:8], ext)
+		outP := filepath.Join(p.b.config.OutputDir, filepath.Dir(filepath.FromSlash(src)), name)
+
+		variants = append(variants, imageVariant{URL: p.b.outURLPath(outP), Width: w, Height: h})
+
+		if p.written[outP] {
+			continue
+		}
+
+		var (
+			cacheP string
+			out    []byte
+		)
+
+		if p.b.config.ImageCacheDir != "" {
+			cacheP = filepath.Join(p.b.config.ImageCacheDir,
+				fmt.Sprintf("%s-%d-q%d-o%d%s", hashS[:16], w, p.b.config.ImageQuality, orientation, ext))
+
+			// A missing cache file means the image was not resized yet
+			out, _ = ioutil.ReadFile(cacheP)
+		}
+
+		if len(out) == 0 {
+			p.b.log.Printf("==> Resizing %q to %dpx", srcP, w)
+
+			// Decode the original at most once
+			if img == nil {
+				img, _, err = image.Decode(bytes.NewReader(fb))
+				if err != nil {
+					return nil, fmt.Errorf("could not decode image %q: %w", srcP, err)
+				}
+
+				img = orient(img, orientation)
+			}
+
+			out, err = encodeImage(resize(img, w, h), format, p.b.config.ImageQuality)
+			if err != nil {
+				return nil, fmt.Errorf("could not encode image %q: %w", srcP, err)
+			}
+
+			if cacheP != "" {
+				err = writeCacheFile(cacheP, out)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		err = p.write(outP, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return variants, nil
+}
+
+func (p *imageProcessor) write(outP string, data []byte) error {
+	err := p.b.out.MkdirAll(filepath.Dir(outP), os.FileMode(readWriteExecute))
+	if err != nil {
+		return fmt.Errorf("could not create directory %q: %w", filepath.Dir(outP), err)
+	}
+
+	outF, err := p.b.mini.Create(outP)
+	if err != nil {
+		return fmt.Errorf("could not create file %q: %w", outP, err)
+	}
+
+	_, err = outF.Write(data)
+	if err != nil {
+		outF.Close()
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	err = outF.Close()
+	if err != nil {
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	p.written[outP] = true
+
+	return nil
+}
+
+func writeCacheFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), os.FileMode(readWriteExecute))
+	if err != nil {
+		return fmt.Errorf("could not create cache dir: %w", err)
+	}
+
+	err = ioutil.WriteFile(path, data, os.FileMode(readWrite))
+	if err != nil {
+		return fmt.Errorf("could not write cache file %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// fitWidths returns the sorted, unique widths that are smaller than max.
+// max itself is included if any width is at least max or if there are no
+// widths.
+func fitWidths(widths []int, max int) []int {
+	seen := make(map[int]bool)
+	fit := make([]int, 0, len(widths))
+
+	for _, w := range widths {
+		if w >= max {
+			w = max
+		}
+
+		if w > 0 && !seen[w] {
+			seen[w] = true
+			fit = append(fit, w)
+		}
+	}
+
+	if len(fit) == 0 {
+		fit = append(fit, max)
+	}
+
+	sort.Ints(fit)
+
+	return fit
+}
+
+// resize scales src to w by h pixels. Each destination pixel is the
+// average of the source pixels it covers, which gives good results when
+// scaling down.
+func resize(src image.Image, w, h int) image.Image {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	// Work on a copy in a known pixel format
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(rgba, rgba.Bounds(), src, sb.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := (y + 1) * sh / h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := (x + 1) * sw / w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				i := rgba.PixOffset(x0+rgba.Rect.Min.X, sy+rgba.Rect.Min.Y)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(rgba.Pix[i])
+					g += uint64(rgba.Pix[i+1])
+					b += uint64(rgba.Pix[i+2])
+					a += uint64(rgba.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	var err error
+	switch format {
+	case "jpeg":
+		if quality <= 0 {
+			quality = jpeg.DefaultQuality
+		}
+
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(buf, img)
+	default:
+		err = fmt.Errorf("%w: %q", errUnsupportedImage, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseTag parses the image tag, which renders an <img> element with
+// a srcset of resized versions of an image in the public dir:
+//
+//	{% image 'photos/me.jpg' widths='400,800,1600' alt='Me' %}
+//
+// All arguments other than widths are output as attributes.
+func parseImageTag(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+	node := &imageTagNode{}
+
+	src, err := arguments.ParseExpression()
+	if err != nil {
+		return nil, err
+	}
+	node.src = src
+
+	for arguments.Remaining() > 0 {
+		key := arguments.MatchType(pongo2.TokenIdentifier)
+		if key == nil {
+			return nil, arguments.Error("expected an attribute name", nil)
+		}
+
+		if arguments.Match(pongo2.TokenSymbol, "=") == nil {
+			return nil, arguments.Error("expected '='", nil)
+		}
+
+		val, err := arguments.ParseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		node.keys = append(node.keys, key.Val)
+		node.vals = append(node.vals, val)
+	}
+
+	return node, nil
+}
+
+type imageTagNode struct {
+	src  pongo2.IEvaluator
+	keys []string
+	vals []pongo2.IEvaluator
+}
+
+func (node *imageTagNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	b := executing.builder()
+	if b == nil {
+		return ctx.OrigError(errNoBuilder, nil)
+	}
+
+	src, err := node.src.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+
+	widths := b.config.ImageWidths
+	attrs := new(strings.Builder)
+
+	for i, key := range node.keys {
+		val, err := node.vals[i].Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+
+		if key == "widths" {
+			widths, err = parseWidths(val.String())
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		fmt.Fprintf(attrs, ` %s="%s"`, key, html.EscapeString(val.String()))
+	}
+
+	variants, perr := b.images.process(src.String(), widths)
+	if perr != nil {
+		return ctx.Error(perr.Error(), nil)
+	}
+
+	srcset := make([]string, len(variants))
+	for i, v := range variants {
+		srcset[i] = fmt.Sprintf("%s %dw", v.URL, v.Width)
+	}
+
+	largest := variants[len(variants)-1]
+
+	_, werr := fmt.Fprintf(writer, `<img src="%s" srcset="%s" width="%d" height="%d"%s>`,
+		largest.URL, strings.Join(srcset, ", "), largest.Width, largest.Height, attrs.String())
+	if werr != nil {
+		return ctx.Error(werr.Error(), nil)
+	}
+
+	return nil
+}
+
+func parseWidths(s string) ([]int, *pongo2.Error) {
+	var widths []int
+
+	for _, field := range strings.Split(s, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || w <= 0 {
+			return nil, &pongo2.Error{
+				Sender:    "tag:image",
+				OrigError: fmt.Errorf("invalid width %q", field),
+			}
+		}
+
+		widths = append(widths, w)
+	}
+
+	return widths, nil
+}
+
+// imageResolver is a goldmark AST transformer that resolves local images
+// in markdown against the public assets. It rewrites their destinations to
+// the output paths and adds their intrinsic dimensions and lazy loading
+// attributes.
+type imageResolver struct {
+	b *Builder
+}
+
+func (r *imageResolver) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	if r.b.config.NoImageAttributes {
+		return
+	}
+
+	publicAssets, ok := pc.Get(assetsKey).(map[string]string)
+	if !ok {
+		return
+	}
+
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := node.(*ast.Image)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		key, ok := resolveAsset(publicAssets, string(img.Destination))
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+
+		img.Destination = []byte(publicAssets[key])
+
+		if w, h, ok := r.b.images.dimensions(key); ok {
+			setDefaultAttr(img, "width", strconv.Itoa(w))
+			setDefaultAttr(img, "height", strconv.Itoa(h))
+		}
+
+		setDefaultAttr(img, "loading", "lazy")
+		setDefaultAttr(img, "decoding", "async")
+
+		return ast.WalkContinue, nil
+	})
+}
+
+var (
+	// assetImageRegexp matches markdown images whose destination is an
+	// asset looked up with the key filter, such as
+	// ![Me]({{ assets|key:'photos/me.jpg' }}).
+	assetImageRegexp = regexp.MustCompile(`(!\[[^\]\n]*\]\(\s*)\{\{-?\s*assets\s*\|\s*key\s*:\s*(?:'([^'\n]*)'|"([^"\n]*)")\s*-?\}\}`)
+)
+
+// resolveAssetImages replaces key filters in the destinations of images in
+// the markdown source src with the output paths of the assets. Goldmark
+// does not parse a template directive as a destination, so without this
+// these images would not be rendered as images and would not get their
+// attributes. Images in code and unknown keys are left as they are.
+func resolveAssetImages(src []byte, publicAssets map[string]string) []byte {
+	masked := maskCode(src)
+
+	out := new(bytes.Buffer)
+	last := 0
+
+	for _, m := range assetImageRegexp.FindAllSubmatchIndex(masked, -1) {
+		// The key is in single or double quotes
+		var key string
+		if m[4] >= 0 {
+			key = string(src[m[4]:m[5]])
+		} else {
+			key = string(src[m[6]:m[7]])
+		}
+
+		outP, ok := publicAssets[filepath.FromSlash(key)]
+		if !ok {
+			continue
+		}
+
+		out.Write(src[last:m[3]])
+		out.WriteString(outP)
+		last = m[1]
+	}
+
+	out.Write(src[last:])
+
+	return out.Bytes()
+}
+
+// resolveAsset returns the key in publicAssets that dest refers to. dest
+// may be a source path relative to the public dir, with or without a
+// leading slash, or an output path such as a hashed file name.
+func resolveAsset(publicAssets map[string]string, dest string) (string, bool) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+
+	key := filepath.FromSlash(strings.TrimPrefix(u.Path, "/"))
+	if _, ok := publicAssets[key]; ok {
+		return key, true
+	}
+
+	for key, outP := range publicAssets {
+		if outP == "/"+strings.TrimPrefix(u.Path, "/") {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// dimensions returns the intrinsic dimensions of the image at key, which
+// is a path relative to the public dir.
+func (p *imageProcessor) dimensions(key string) (int, int, bool) {
+	if dims, ok := p.dims[key]; ok {
+		return dims[0], dims[1], dims[0] > 0
+	}
+
+	var dims [2]int
+
+	fp, err := os.Open(filepath.Join(p.b.config.PublicDir, key))
+	if err == nil {
+		defer fp.Close()
+
+		if cfg, _, err := image.DecodeConfig(fp); err == nil {
+			dims = [2]int{cfg.Width, cfg.Height}
+		}
+
+		// Browsers display images upright, so the dimensions are swapped
+		// for images that are rotated by 90°
+		if _, err := fp.Seek(0, io.SeekStart); err == nil && exifOrientation(fp) >= 5 {
+			dims[0], dims[1] = dims[1], dims[0]
+		}
+	}
+
+	p.dims[key] = dims
+
+	return dims[0], dims[1], dims[0] > 0
+}
+
+func setDefaultAttr(n ast.Node, name, val string) {
+	if _, ok := n.AttributeString(name); !ok {
+		n.SetAttributeString(name, []byte(val))
+	}
+}
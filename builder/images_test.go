@@ -0,0 +1,180 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFitWidths(t *testing.T) {
+	tests := []struct {
+		Widths []int
+		Max    int
+		Expect []int
+	}{
+		{Widths: []int{800, 400}, Max: 1000, Expect: []int{400, 800}},
+		{Widths: []int{400, 800, 1600}, Max: 1000, Expect: []int{400, 800, 1000}},
+		{Widths: []int{400, 400}, Max: 1000, Expect: []int{400}},
+		{Widths: nil, Max: 1000, Expect: []int{1000}},
+	}
+
+	for _, tcase := range tests {
+		if out := fitWidths(tcase.Widths, tcase.Max); !reflect.DeepEqual(out, tcase.Expect) {
+			t.Errorf("expected %v but got %v", tcase.Expect, out)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		src.Set(x, 0, color.NRGBA{R: 255, A: 255})
+		src.Set(x, 1, color.NRGBA{B: 255, A: 255})
+	}
+
+	dst := resize(src, 2, 1)
+	if dst.Bounds().Dx() != 2 || dst.Bounds().Dy() != 1 {
+		t.Fatalf("expected 2x1 image but got %v", dst.Bounds())
+	}
+
+	r, g, b, a := dst.At(0, 0).RGBA()
+	if r>>8 != 127 || g != 0 || b>>8 != 127 || a>>8 != 255 {
+		t.Errorf("expected averaged pixel but got %d %d %d %d", r>>8, g>>8, b>>8, a>>8)
+	}
+}
+
+func TestResolveAsset(t *testing.T) {
+	publicAssets := map[string]string{
+		"photos/me.jpg": "/photos/me.jpg",
+		"styles.css":    "/styles.df1b98dd.css",
+	}
+
+	tests := []struct {
+		Dest   string
+		Expect string
+		OK     bool
+	}{
+		{Dest: "photos/me.jpg", Expect: "photos/me.jpg", OK: true},
+		{Dest: "/photos/me.jpg", Expect: "photos/me.jpg", OK: true},
+		{Dest: "/styles.df1b98dd.css", Expect: "styles.css", OK: true},
+		{Dest: "https://example.com/photos/me.jpg", OK: false},
+		{Dest: "photos/missing.jpg", OK: false},
+	}
+
+	for _, tcase := range tests {
+		key, ok := resolveAsset(publicAssets, tcase.Dest)
+		if ok != tcase.OK || key != tcase.Expect {
+			t.Errorf("expected %q, %t for %q but got %q, %t", tcase.Expect, tcase.OK, tcase.Dest, key, ok)
+		}
+	}
+}
+
+func TestMarkdownImages(t *testing.T) {
+	img := new(bytes.Buffer)
+
+	err := png.Encode(img, image.NewNRGBA(image.Rect(0, 0, 3, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chdirSite(t, map[string]string{
+		"includes/page.html": "{{ content|safe }}",
+		"pages/about.md": "![a](me.png)\n\n" +
+			"![b]({{ assets|key:'me.png' }})\n\n" +
+			"![c]({{ assets|key:'missing.png' }})\n\n" +
+			"`![d]({{ assets|key:'me.png' }})`\n",
+		"public/me.png": img.String(),
+	})
+
+	tests := []struct {
+		Name         string
+		NoAttributes bool
+		Expect       string
+	}{
+		{
+			Name: "attributes",
+			Expect: `<p><img src="%[1]s" alt="a" width="3" height="2" loading="lazy" decoding="async"></p>
+<p><img src="%[1]s" alt="b" width="3" height="2" loading="lazy" decoding="async"></p>
+<p>![c]()</p>
+<p><code>![d](&#123;&#123; assets|key:'me.png' }})</code></p>`,
+		},
+		{
+			Name:         "no attributes",
+			NoAttributes: true,
+			Expect: `<p><img src="me.png" alt="a"></p>
+<p>![b](%[1]s)</p>
+<p>![c]()</p>
+<p><code>![d](&#123;&#123; assets|key:'me.png' }})</code></p>`,
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			c := newTestSiteConfig()
+			c.NoImageAttributes = tcase.NoAttributes
+			c.HashExts = []string{".png"}
+
+			out := NewMemFS()
+			c.OutputFS = out
+
+			b, err := New(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fb, err := out.ReadFile(filepath.Join("build", "about.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expect := fmt.Sprintf(tcase.Expect, b.Assets()["me.png"])
+			if got := strings.TrimSpace(string(fb)); got != expect {
+				t.Errorf("expected %q but got %q", expect, got)
+			}
+		})
+	}
+}
+
+func TestMarkdownImagesWithoutTemplating(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html": "{{ content|safe }}",
+		"pages/about.md":     "---\ntemplating: false\n---\n![a]({{ assets|key:'me.png' }})\n",
+		"public/me.png":      "png",
+	})
+
+	c := newTestSiteConfig()
+
+	out := NewMemFS()
+	c.OutputFS = out
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fb, err := out.ReadFile(filepath.Join("build", "about.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "<p>![a]({{ assets|key:'me.png' }})</p>"
+	if got := strings.TrimSpace(string(fb)); got != expect {
+		t.Errorf("expected %q but got %q", expect, got)
+	}
+}
@@ -0,0 +1,187 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+var (
+	errBrokenLink    = errors.New("link to nonexistent file")
+	errGeneratorLink = errors.New(`link to a page with a "generate" directive, which is not written`)
+)
+
+const (
+	// BrokenLinksWarn logs links to nonexistent markdown files.
+	BrokenLinksWarn = "warn"
+	// BrokenLinksError fails the build on links to nonexistent markdown
+	// files.
+	BrokenLinksError = "error"
+)
+
+var (
+	// srcPathKey holds the path of the markdown file being parsed.
+	srcPathKey = parser.NewContextKey()
+	// linkErrKey holds the first error encountered while resolving links.
+	linkErrKey = parser.NewContextKey()
+)
+
+// gatherSourceURLs returns a map of the paths of all markdown pages and
+// posts to the relative URLs of their outputs. Pages with a "generate"
+// directive map to an empty URL, because they have no output of their own.
+func (b *Builder) gatherSourceURLs() (map[string]string, error) {
+	urls := make(map[string]string)
+
+	for _, dir := range []string{b.config.PagesDir, b.config.PostsDir} {
+		if dir == "" {
+			continue
+		}
+
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if path == dir && os.IsNotExist(err) {
+					return nil
+				}
+
+				return err
+			}
+
+			if info.IsDir() || filepath.Ext(path) != ".md" {
+				return nil
+			}
+
+			if dir == b.config.PostsDir {
+				urls[filepath.Clean(path)] = b.outURLPath(b.postOutPath(path))
+				return nil
+			}
+
+			generates, err := b.generatesPages(path)
+			if err != nil {
+				return err
+			}
+
+			if generates {
+				urls[filepath.Clean(path)] = ""
+			} else {
+				urls[filepath.Clean(path)] = b.outURLPath(b.mdPageOutPath(path))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking %q dir: %w", dir, err)
+		}
+	}
+
+	return urls, nil
+}
+
+// generatesPages reports whether the markdown page at path has a "generate"
+// directive in its front matter or its defaults.
+func (b *Builder) generatesPages(path string) (bool, error) {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("could not read markdown file %q: %w", path, err)
+	}
+
+	fm, _ := splitFrontMatter(fb)
+
+	items, err := parseFrontMatter(fm)
+	if err != nil {
+		return false, fmt.Errorf("could not parse front-matter on %q: %w", path, err)
+	}
+
+	frontMatter, err := msi2mss(items)
+	if err != nil {
+		return false, fmt.Errorf("could not process front-matter on %q: %w", path, err)
+	}
+
+	frontMatter, err = b.withDefaults(path, frontMatter)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := frontMatter["generate"]
+
+	return ok, nil
+}
+
+// linkResolver is a goldmark AST transformer that rewrites relative links
+// to markdown files into links to their outputs.
+type linkResolver struct {
+	b *Builder
+}
+
+func (r *linkResolver) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	srcP, ok := pc.Get(srcPathKey).(string)
+	if !ok {
+		return
+	}
+
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		link, ok := node.(*ast.Link)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		dest, err := r.resolve(srcP, string(link.Destination))
+		switch {
+		case err == nil:
+		case r.b.config.Strict:
+			// The error names the markdown file already
+			r.b.problems = append(r.b.problems, err)
+		case r.b.config.BrokenLinks == BrokenLinksError:
+			if pc.Get(linkErrKey) == nil {
+				pc.Set(linkErrKey, err)
+			}
+		default:
+			r.b.log.Printf("WARNING: %s", err)
+		}
+
+		if dest != "" {
+			link.Destination = []byte(dest)
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
+
+// resolve returns the URL of the output of the markdown file that dest
+// refers to. If dest is not a relative link to a markdown file, an empty
+// string is returned.
+func (r *linkResolver) resolve(srcP, dest string) (string, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" ||
+		strings.HasPrefix(u.Path, "/") || filepath.Ext(u.Path) != ".md" {
+		return "", nil
+	}
+
+	target := filepath.Join(filepath.Dir(srcP), filepath.FromSlash(u.Path))
+
+	outURL, ok := r.b.sourceURLs[target]
+	if !ok {
+		return "", fmt.Errorf("%w: %q in %q", errBrokenLink, dest, srcP)
+	}
+
+	if outURL == "" {
+		return "", fmt.Errorf("%w: %q in %q", errGeneratorLink, dest, srcP)
+	}
+
+	if u.RawQuery != "" {
+		outURL += "?" + u.RawQuery
+	}
+
+	if u.Fragment != "" {
+		outURL += "#" + u.Fragment
+	}
+
+	return outURL, nil
+}
@@ -0,0 +1,96 @@
+package builder
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveLink(t *testing.T) {
+	r := &linkResolver{b: &Builder{
+		config: &Config{},
+		sourceURLs: map[string]string{
+			"pages/about.md":      "/about.html",
+			"pages/contact.md":    "/contact.html",
+			"pages/docs/intro.md": "/docs/intro.html",
+			"pages/docs/setup.md": "/docs/setup.html",
+			"posts/first-post.md": "/posts/first-post.html",
+			"pages/products.md":   "",
+		},
+	}}
+
+	tests := []struct {
+		Name   string
+		Src    string
+		Dest   string
+		Expect string
+		Err    error
+	}{
+		{
+			Name:   "sibling",
+			Src:    "pages/about.md",
+			Dest:   "contact.md",
+			Expect: "/contact.html",
+		},
+		{
+			Name:   "sibling in subdir",
+			Src:    "pages/docs/intro.md",
+			Dest:   "./setup.md",
+			Expect: "/docs/setup.html",
+		},
+		{
+			Name:   "subdir",
+			Src:    "pages/about.md",
+			Dest:   "docs/intro.md",
+			Expect: "/docs/intro.html",
+		},
+		{
+			Name:   "parent dir",
+			Src:    "pages/docs/intro.md",
+			Dest:   "../about.md",
+			Expect: "/about.html",
+		},
+		{
+			Name:   "posts dir with fragment",
+			Src:    "pages/docs/intro.md",
+			Dest:   "../../posts/first-post.md#top",
+			Expect: "/posts/first-post.html#top",
+		},
+		{
+			Name:   "absolute url",
+			Src:    "pages/about.md",
+			Dest:   "https://example.com/README.md",
+			Expect: "",
+		},
+		{
+			Name:   "not markdown",
+			Src:    "pages/about.md",
+			Dest:   "about.html",
+			Expect: "",
+		},
+		{
+			Name: "generating page",
+			Src:  "pages/about.md",
+			Dest: "products.md",
+			Err:  errGeneratorLink,
+		},
+		{
+			Name: "nonexistent",
+			Src:  "pages/about.md",
+			Dest: "missing.md",
+			Err:  errBrokenLink,
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			dest, err := r.resolve(tcase.Src, tcase.Dest)
+			if !errors.Is(err, tcase.Err) {
+				t.Fatalf("expected error %v but got %v", tcase.Err, err)
+			}
+
+			if dest != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, dest)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexanderRichey/yagss/mini"
+)
+
+var errNotFile = errors.New("not a file")
+
+// OutputFS is a filesystem that a Builder writes its output to.
+type OutputFS interface {
+	mini.FS
+	MkdirAll(path string, perm os.FileMode) error
+	RemoveAll(path string) error
+}
+
+// DiskFS is an OutputFS that writes to the filesystem of the operating
+// system.
+type DiskFS struct{}
+
+// Create creates or truncates the file at path with os.Create.
+func (DiskFS) Create(path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+// MkdirAll creates the directory at path and any missing parents with
+// os.MkdirAll.
+func (DiskFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// RemoveAll removes path and anything it contains with os.RemoveAll.
+func (DiskFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+// MemFS is an OutputFS that keeps files in memory. It is safe for
+// concurrent use, so a site can be served while it is rebuilt.
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memEntry
+}
+
+// memEntry is a file or directory in a MemFS.
+type memEntry struct {
+	data    []byte
+	dir     bool
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string]*memEntry)}
+}
+
+// memPath returns the key of p in a MemFS.
+func memPath(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// Create creates or truncates the file at p. Its content is stored when
+// the returned writer is closed. Like os.Create, the parent directory of p
+// must exist.
+func (m *MemFS) Create(p string) (io.WriteCloser, error) {
+	p = memPath(p)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if dir := path.Dir(p); dir != "." {
+		if e, ok := m.files[dir]; !ok || !e.dir {
+			return nil, &os.PathError{Op: "create", Path: p, Err: os.ErrNotExist}
+		}
+	}
+
+	if e, ok := m.files[p]; ok && e.dir {
+		return nil, &os.PathError{Op: "create", Path: p, Err: errNotFile}
+	}
+
+	return &memWriter{fs: m, path: p}, nil
+}
+
+// MkdirAll creates the directory at p and any missing parents. perm is
+// ignored.
+func (m *MemFS) MkdirAll(p string, perm os.FileMode) error {
+	p = memPath(p)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for ; p != "." && p != "/"; p = path.Dir(p) {
+		if e, ok := m.files[p]; ok {
+			if !e.dir {
+				return &os.PathError{Op: "mkdir", Path: p, Err: errNotDir}
+			}
+
+			continue
+		}
+
+		m.files[p] = &memEntry{dir: true, modTime: time.Now()}
+	}
+
+	return nil
+}
+
+// RemoveAll removes p and anything it contains. Like os.RemoveAll, it
+// returns nil if p doesn't exist.
+func (m *MemFS) RemoveAll(p string) error {
+	p = memPath(p)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name := range m.files {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			delete(m.files, name)
+		}
+	}
+
+	return nil
+}
+
+// ReadFile returns the content of the file at p.
+func (m *MemFS) ReadFile(p string) ([]byte, error) {
+	p = memPath(p)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.files[p]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: p, Err: os.ErrNotExist}
+	}
+
+	if e.dir {
+		return nil, &os.PathError{Op: "read", Path: p, Err: errNotFile}
+	}
+
+	return e.data, nil
+}
+
+// HTTPFileSystem returns an http.FileSystem of the files in the directory
+// root, such as the output dir of a Builder, for use with http.FileServer.
+func (m *MemFS) HTTPFileSystem(root string) http.FileSystem {
+	return &memHTTPFS{fs: m, root: memPath(root)}
+}
+
+// memWriter buffers the content of a file in a MemFS.
+type memWriter struct {
+	fs   *MemFS
+	path string
+	buf  bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	w.fs.files[w.path] = &memEntry{data: w.buf.Bytes(), modTime: time.Now()}
+
+	return nil
+}
+
+type memHTTPFS struct {
+	fs   *MemFS
+	root string
+}
+
+func (h *memHTTPFS) Open(name string) (http.File, error) {
+	p := path.Join(h.root, path.Clean("/"+name))
+
+	h.fs.mu.RLock()
+	defer h.fs.mu.RUnlock()
+
+	e, ok := h.fs.files[p]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	f := &memFile{
+		Reader: bytes.NewReader(e.data),
+		info:   &memFileInfo{name: path.Base(p), entry: e},
+	}
+
+	// Directories are listed when they are opened because the files in
+	// them may change afterwards
+	if e.dir {
+		for name, child := range h.fs.files {
+			if path.Dir(name) == p {
+				f.children = append(f.children, &memFileInfo{name: path.Base(name), entry: child})
+			}
+		}
+
+		sort.Slice(f.children, func(i, j int) bool {
+			return f.children[i].Name() < f.children[j].Name()
+		})
+	}
+
+	return f, nil
+}
+
+// memFile is a file or directory of a MemFS opened for reading.
+type memFile struct {
+	*bytes.Reader
+	info     *memFileInfo
+	children []os.FileInfo
+	// read is the number of children returned by Readdir
+	read int
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.IsDir() {
+		return nil, fmt.Errorf("%w: %q", errNotDir, f.info.Name())
+	}
+
+	rest := f.children[f.read:]
+	if count <= 0 {
+		f.read = len(f.children)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(rest) {
+		count = len(rest)
+	}
+
+	f.read += count
+
+	return rest[:count], nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+type memFileInfo struct {
+	name  string
+	entry *memEntry
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return int64(len(i.entry.data)) }
+func (i *memFileInfo) ModTime() time.Time { return i.entry.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.entry.dir }
+func (i *memFileInfo) Sys() interface{}   { return nil }
+
+func (i *memFileInfo) Mode() os.FileMode {
+	if i.entry.dir {
+		return os.ModeDir | os.FileMode(readWriteExecute)
+	}
+
+	return os.FileMode(readWrite)
+}
@@ -0,0 +1,87 @@
+package builder
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMemFS(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir("../example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err := os.Chdir(wd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	c, err := ReadConfig(ConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := NewMemFS()
+	c.OutputDir = "mem-build"
+	c.OutputFS = out
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(c.OutputDir); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written to disk but got %v", err)
+	}
+
+	srv := httptest.NewServer(http.FileServer(out.HTTPFileSystem(c.OutputDir)))
+	defer srv.Close()
+
+	tests := []struct {
+		Path     string
+		Status   int
+		Contains string
+	}{
+		{Path: "/", Status: http.StatusOK, Contains: "<html"},
+		{Path: "/page2/", Status: http.StatusOK, Contains: "<html"},
+		{Path: "/about.html", Status: http.StatusOK, Contains: "<html"},
+		{Path: "/missing.html", Status: http.StatusNotFound},
+	}
+
+	for _, tcase := range tests {
+		res, err := http.Get(srv.URL + tcase.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != tcase.Status {
+			t.Errorf("%s: expected status %d but got %d", tcase.Path, tcase.Status, res.StatusCode)
+		}
+
+		if !strings.Contains(string(body), tcase.Contains) {
+			t.Errorf("%s: expected body to contain %q", tcase.Path, tcase.Contains)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+// Plugin extends a Builder. Plugins are passed to New and implement any of
+// the hook interfaces below, which are called in the order the plugins are
+// passed. An error returned by a hook aborts the build.
+type Plugin interface {
+	// Name identifies the plugin in errors.
+	Name() string
+}
+
+// BeforeBuildHook is called after the output dir is cleaned and before
+// anything is built.
+type BeforeBuildHook interface {
+	BeforeBuild(b *Builder) error
+}
+
+// PostParsedHook is called for every post after its markdown is rendered
+// and before any post is written. Changes to the post are used in all
+// outputs.
+type PostParsedHook interface {
+	OnPostParsed(post *Post) error
+}
+
+// PageRenderedHook is called for every file rendered from a template,
+// including posts, pages, post indexes, and the RSS feed, before it is
+// minified and written.
+type PageRenderedHook interface {
+	OnPageRendered(page *Page) error
+}
+
+// AfterBuildHook is called after everything is built.
+type AfterBuildHook interface {
+	AfterBuild(b *Builder) error
+}
+
+// TemplateFiltersHook returns filters that are available in the templates
+// of the Builder.
+type TemplateFiltersHook interface {
+	TemplateFilters() map[string]pongo2.FilterFunction
+}
+
+// Page is a file rendered from a template.
+type Page struct {
+	// Path is the output path of the page.
+	Path string
+	// URL is the relative URL of the page.
+	URL string
+	// Content is the rendered page. Hooks may replace it.
+	Content []byte
+}
+
+// Config returns the config of the Builder.
+func (b *Builder) Config() *Config {
+	return b.config
+}
+
+// Posts returns the posts of the current build ordered by date, newest
+// first. It returns nil before the posts are parsed.
+func (b *Builder) Posts() []*Post {
+	return b.posts
+}
+
+// Assets returns the map of the source paths of public assets to their
+// output URLs in the current build. It returns nil before the public
+// assets are processed.
+func (b *Builder) Assets() map[string]string {
+	return b.assets
+}
+
+// Data returns the contents of the data files of the current build. Plugins
+// can add to it before the site is rendered. It returns nil before the data
+// files are loaded.
+func (b *Builder) Data() map[string]interface{} {
+	return b.data
+}
+
+// WriteFile writes content to the file name in the output dir. Parent
+// directories are created as needed and content is minified according to
+// the extension of name.
+func (b *Builder) WriteFile(name string, content []byte) error {
+	outP := filepath.Join(b.config.OutputDir, filepath.FromSlash(name))
+
+	err := b.out.MkdirAll(filepath.Dir(outP), os.FileMode(readWriteExecute))
+	if err != nil {
+		return fmt.Errorf("could not create directory %q: %w", filepath.Dir(outP), err)
+	}
+
+	outF, err := b.mini.Create(outP)
+	if err != nil {
+		return fmt.Errorf("could not create file %q: %w", outP, err)
+	}
+
+	_, err = outF.Write(content)
+	if err != nil {
+		outF.Close()
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	err = outF.Close()
+	if err != nil {
+		return fmt.Errorf("could not write file %q: %w", outP, err)
+	}
+
+	b.counter++
+
+	return nil
+}
+
+// addPluginFilters adds the template filters of plugins to the filters of
+// the Builder. Plugin filters replace built-in filters of the same name, but
+// not the filters of pongo2 or the program.
+func (b *Builder) addPluginFilters() error {
+	for _, p := range b.plugins {
+		h, ok := p.(TemplateFiltersHook)
+		if !ok {
+			continue
+		}
+
+		for name, fn := range h.TemplateFilters() {
+			err := registerFilter(name)
+			if err != nil {
+				return fmt.Errorf("plugin %q: %w", p.Name(), err)
+			}
+
+			b.filters[name] = fn
+		}
+	}
+
+	return nil
+}
+
+func (b *Builder) runBeforeBuild() error {
+	for _, p := range b.plugins {
+		if h, ok := p.(BeforeBuildHook); ok {
+			if err := h.BeforeBuild(b); err != nil {
+				return fmt.Errorf("plugin %q: before build: %w", p.Name(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Builder) runPostParsed(post *Post) error {
+	for _, p := range b.plugins {
+		if h, ok := p.(PostParsedHook); ok {
+			if err := h.OnPostParsed(post); err != nil {
+				return fmt.Errorf("plugin %q: post %q parsed: %w", p.Name(), post.localSrcPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Builder) runPageRendered(page *Page) error {
+	for _, p := range b.plugins {
+		if h, ok := p.(PageRenderedHook); ok {
+			if err := h.OnPageRendered(page); err != nil {
+				return fmt.Errorf("plugin %q: page %q rendered: %w", p.Name(), page.Path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Builder) runAfterBuild() error {
+	for _, p := range b.plugins {
+		if h, ok := p.(AfterBuildHook); ok {
+			if err := h.AfterBuild(b); err != nil {
+				return fmt.Errorf("plugin %q: after build: %w", p.Name(), err)
+			}
+		}
+	}
+
+	return nil
+}
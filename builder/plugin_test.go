@@ -0,0 +1,188 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+type testPlugin struct {
+	calls  []string
+	posts  int
+	pages  int
+	failOn string
+}
+
+var errTestPlugin = errors.New("test plugin failed")
+
+func (p *testPlugin) Name() string { return "test" }
+
+func (p *testPlugin) fail(hook string) error {
+	p.calls = append(p.calls, hook)
+	if p.failOn == hook {
+		return errTestPlugin
+	}
+
+	return nil
+}
+
+func (p *testPlugin) BeforeBuild(b *Builder) error {
+	return p.fail("BeforeBuild")
+}
+
+func (p *testPlugin) OnPostParsed(post *Post) error {
+	p.posts++
+	post.Title = strings.ToUpper(post.Title)
+	return p.fail("OnPostParsed")
+}
+
+func (p *testPlugin) OnPageRendered(page *Page) error {
+	p.pages++
+	page.Content = bytes.Replace(page.Content, []byte("</body>"), []byte("<p id=plugin></p></body>"), 1)
+	return p.fail("OnPageRendered")
+}
+
+func (p *testPlugin) AfterBuild(b *Builder) error {
+	var index strings.Builder
+	for _, post := range b.Posts() {
+		index.WriteString(post.Title + "\n")
+	}
+
+	err := b.WriteFile("titles.txt", []byte(index.String()))
+	if err != nil {
+		return err
+	}
+
+	return p.fail("AfterBuild")
+}
+
+func (p *testPlugin) TemplateFilters() map[string]pongo2.FilterFunction {
+	return map[string]pongo2.FilterFunction{
+		"shout": func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			return pongo2.AsValue(strings.ToUpper(in.String()) + "!"), nil
+		},
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir("../example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err := os.Chdir(wd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("hooks", func(t *testing.T) {
+		c, err := ReadConfig(ConfigFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := NewMemFS()
+		c.OutputDir = "mem-build"
+		c.OutputFS = out
+
+		p := &testPlugin{}
+
+		b, err := New(c, nil, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.calls[0] != "BeforeBuild" || p.calls[len(p.calls)-1] != "AfterBuild" {
+			t.Errorf("expected hooks to run from BeforeBuild to AfterBuild but got %v", p.calls)
+		}
+
+		if p.posts == 0 || p.posts != len(b.Posts()) {
+			t.Errorf("expected OnPostParsed to run for %d posts but ran %d times", len(b.Posts()), p.posts)
+		}
+
+		if p.pages == 0 {
+			t.Errorf("expected OnPageRendered to run")
+		}
+
+		titles, err := out.ReadFile(filepath.Join(c.OutputDir, "titles.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, post := range b.Posts() {
+			if post.Title != strings.ToUpper(post.Title) {
+				t.Errorf("expected post title %q to be changed by plugin", post.Title)
+			}
+
+			if !strings.Contains(string(titles), post.Title) {
+				t.Errorf("expected titles.txt to contain %q", post.Title)
+			}
+		}
+
+		index, err := out.ReadFile(filepath.Join(c.OutputDir, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Contains(index, []byte("id=plugin")) {
+			t.Errorf("expected index.html to contain plugin output")
+		}
+
+		tpl, err := b.fromString("{{ 'hi'|shout }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := b.execute(tpl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s != "HI!" {
+			t.Errorf("expected plugin filter to render %q but got %q", "HI!", s)
+		}
+	})
+
+	for _, hook := range []string{"BeforeBuild", "OnPostParsed", "OnPageRendered", "AfterBuild"} {
+		t.Run("abort on "+hook, func(t *testing.T) {
+			c, err := ReadConfig(ConfigFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c.OutputDir = "mem-build"
+			c.OutputFS = NewMemFS()
+
+			b, err := New(c, nil, &testPlugin{failOn: hook})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if !errors.Is(err, errTestPlugin) {
+				t.Fatalf("expected %v but got %v", errTestPlugin, err)
+			}
+
+			if !strings.Contains(err.Error(), `plugin "test"`) {
+				t.Errorf("expected error to name the plugin but got %q", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Problems is the error returned by a strict build that found problems,
+// such as unknown asset keys and links to markdown files that don't exist.
+// Strict builds do not stop at the first problem, so that all of them are
+// reported at once.
+type Problems []error
+
+func (p Problems) Error() string {
+	msgs := make([]string, len(p))
+	for i, err := range p {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("found %d problems:\n%s", len(p), strings.Join(msgs, "\n"))
+}
+
+// Is reports whether any of the problems is target.
+func (p Problems) Is(target error) bool {
+	for _, err := range p {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addProblem records err as a problem of the file being processed.
+func (b *Builder) addProblem(err error) {
+	if b.current != "" {
+		err = fmt.Errorf("%s: %w", b.current, err)
+	}
+
+	b.problems = append(b.problems, err)
+}
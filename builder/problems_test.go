@@ -0,0 +1,63 @@
+package builder
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStrictProblems(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html": "{{ content|safe }}",
+		"pages/a.md":         "{{ assets|key:'a.css' }}\n\n[b](b.md)\n",
+		"pages/b.html":       "{{ 'b.css'|asset }}{{ 'b.js'|integrity }}",
+		"public/.keep":       "",
+	})
+
+	c := newTestSiteConfig()
+	c.Strict = true
+
+	out := NewMemFS()
+	c.OutputFS = out
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+
+	var problems Problems
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected problems but got %v", err)
+	}
+
+	if !errors.Is(err, errUnknownAsset) {
+		t.Errorf("expected %v to be %v", err, errUnknownAsset)
+	}
+
+	expect := []string{
+		`a.md: unknown asset: "a.css"`,
+		`"b.md"`,
+		`b.html: unknown asset: "b.css"`,
+		`b.html: unknown asset: "b.js"`,
+	}
+
+	if len(problems) != len(expect) {
+		t.Fatalf("expected %d problems but got %d: %v", len(expect), len(problems), err)
+	}
+
+	for _, e := range expect {
+		if !strings.Contains(err.Error(), e) {
+			t.Errorf("expected %q in %q", e, err.Error())
+		}
+	}
+
+	// Everything is built before the problems are reported
+	for _, name := range []string{"a.html", "b.html"} {
+		if _, err := out.ReadFile(filepath.Join("build", name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// HooksDir is the directory inside the includes directory that contains
+// render hook templates.
+const HooksDir = "_hooks"
+
+const (
+	hookLink      = "link"
+	hookImage     = "image"
+	hookHeading   = "heading"
+	hookCodeBlock = "codeblock"
+)
+
+// renderHooks is a goldmark renderer that renders links, images, headings,
+// and code blocks with the templates in HooksDir instead of the default
+// renderers.
+type renderHooks struct {
+	b     *Builder
+	hooks map[string]bool
+	// highlight renders code blocks the way they would be rendered without
+	// a hook. Its output is passed to the code block hook.
+	highlight renderer.NodeRendererFunc
+}
+
+// findRenderHooks returns the set of hooks that have a template in
+// HooksDir.
+func findRenderHooks(templatesDir string) map[string]bool {
+	hooks := make(map[string]bool)
+
+	for _, name := range []string{hookLink, hookImage, hookHeading, hookCodeBlock} {
+		info, err := os.Stat(filepath.Join(templatesDir, HooksDir, name+".html"))
+		if err == nil && !info.IsDir() {
+			hooks[name] = true
+		}
+	}
+
+	return hooks
+}
+
+func newRenderHooks(b *Builder, hooks map[string]bool, highlighter renderer.NodeRenderer) *renderHooks {
+	r := &renderHooks{b: b, hooks: hooks}
+
+	// Capture the highlighter's code block renderer
+	fns := make(funcRegisterer)
+	highlighter.RegisterFuncs(fns)
+	r.highlight = fns[ast.KindFencedCodeBlock]
+
+	return r
+}
+
+func (r *renderHooks) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	if r.hooks[hookLink] {
+		reg.Register(ast.KindLink, r.renderLink)
+	}
+
+	if r.hooks[hookImage] {
+		reg.Register(ast.KindImage, r.renderImage)
+	}
+
+	if r.hooks[hookHeading] {
+		reg.Register(ast.KindHeading, r.renderHeading)
+	}
+
+	if r.hooks[hookCodeBlock] {
+		reg.Register(ast.KindFencedCodeBlock, r.renderCodeBlock)
+		reg.Register(ast.KindCodeBlock, r.renderCodeBlock)
+	}
+}
+
+func (r *renderHooks) renderLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.Link)
+
+	text, err := r.renderChildren(source, n)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	dest := string(n.Destination)
+
+	err = r.execute(w, hookLink, pongo2.Context{
+		"destination": dest,
+		"title":       string(n.Title),
+		"text":        text,
+		"isExternal": strings.HasPrefix(dest, "http://") ||
+			strings.HasPrefix(dest, "https://") ||
+			strings.HasPrefix(dest, "//"),
+	})
+
+	return ast.WalkSkipChildren, err
+}
+
+func (r *renderHooks) renderImage(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.Image)
+
+	err := r.execute(w, hookImage, pongo2.Context{
+		"destination": string(n.Destination),
+		"title":       string(n.Title),
+		"alt":         string(n.Text(source)),
+		"attributes":  attributes(n),
+	})
+
+	return ast.WalkSkipChildren, err
+}
+
+func (r *renderHooks) renderHeading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.Heading)
+
+	text, err := r.renderChildren(source, n)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	err = r.execute(w, hookHeading, pongo2.Context{
+		"level":      n.Level,
+		"text":       text,
+		"plainText":  string(n.Text(source)),
+		"id":         attributes(n)["id"],
+		"attributes": attributes(n),
+	})
+
+	return ast.WalkSkipChildren, err
+}
+
+func (r *renderHooks) renderCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	code := new(bytes.Buffer)
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		code.Write(seg.Value(source))
+	}
+
+	var (
+		lang        string
+		highlighted string
+	)
+
+	if n, ok := node.(*ast.FencedCodeBlock); ok {
+		lang = string(n.Language(source))
+
+		buf := new(bytes.Buffer)
+		bw := bufio.NewWriter(buf)
+
+		_, err := r.highlight(bw, source, n, true)
+		if err != nil {
+			return ast.WalkStop, fmt.Errorf("could not highlight code block: %w", err)
+		}
+
+		err = bw.Flush()
+		if err != nil {
+			return ast.WalkStop, fmt.Errorf("could not highlight code block: %w", err)
+		}
+
+		highlighted = buf.String()
+	}
+
+	s, err := r.render(hookCodeBlock, pongo2.Context{
+		"language":    lang,
+		"code":        code.String(),
+		"highlighted": highlighted,
+	})
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	// The output is substituted after the template directives of the
+	// document are evaluated, since the hook can put code in any element
+	_, err = w.WriteString(r.b.addCodeBlock(s))
+
+	return ast.WalkSkipChildren, err
+}
+
+// renderChildren renders the children of n with the builder's markdown
+// renderer and returns the result.
+func (r *renderHooks) renderChildren(source []byte, n ast.Node) (string, error) {
+	buf := new(bytes.Buffer)
+
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		err := r.b.markdown.Renderer().Render(buf, source, c)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return buf.String(), nil
+}
+
+func (r *renderHooks) execute(w util.BufWriter, name string, p2ctx pongo2.Context) error {
+	s, err := r.render(name, p2ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteString(s)
+
+	return err
+}
+
+// render returns the output of the hook template name.
+func (r *renderHooks) render(name string, p2ctx pongo2.Context) (string, error) {
+	tplP := HooksDir + "/" + name + ".html"
+
+	tpl, err := r.b.fromFile(tplP)
+	if err != nil {
+		return "", fmt.Errorf("could not get render hook %q: %w", tplP, err)
+	}
+
+	s, err := r.b.execute(tpl, p2ctx)
+	if err != nil {
+		return "", fmt.Errorf("could not render hook %q: %w", tplP, err)
+	}
+
+	return s, nil
+}
+
+// addCodeBlock stores the output of the code block hook and returns the
+// placeholder to write in its place. Like shortcode placeholders, it is a
+// plain word.
+func (b *Builder) addCodeBlock(s string) string {
+	if b.codeBlocks == nil {
+		b.codeBlocks = make(map[string]string)
+	}
+
+	key := fmt.Sprintf("yagsscodeblock%dx", len(b.codeBlocks))
+	b.codeBlocks[key] = s
+
+	return key
+}
+
+// takeCodeBlocks returns the code blocks stored since it was last called,
+// keyed by their placeholders.
+func (b *Builder) takeCodeBlocks() map[string]string {
+	blocks := b.codeBlocks
+	b.codeBlocks = nil
+
+	return blocks
+}
+
+// attributes returns the attributes of n as a map of strings.
+func attributes(n ast.Node) map[string]string {
+	attrs := make(map[string]string)
+
+	for _, attr := range n.Attributes() {
+		switch v := attr.Value.(type) {
+		case []byte:
+			attrs[string(attr.Name)] = string(v)
+		default:
+			attrs[string(attr.Name)] = fmt.Sprint(v)
+		}
+	}
+
+	return attrs
+}
+
+// funcRegisterer collects the functions registered by a NodeRenderer.
+type funcRegisterer map[ast.NodeKind]renderer.NodeRendererFunc
+
+func (f funcRegisterer) Register(kind ast.NodeKind, fn renderer.NodeRendererFunc) {
+	f[kind] = fn
+}
@@ -0,0 +1,136 @@
+package builder
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderHooks(t *testing.T) {
+	page := "# Hello *world*\n\n" +
+		"[home](/index.html) [ext](https://example.com \"Ex\")\n\n" +
+		"![me](/me.png \"Me\")\n\n" +
+		"```go\nx := 1\n```\n\n" +
+		"    indented\n"
+
+	hooks := map[string]string{
+		"link": `<a href="{{ destination }}" title="{{ title }}"` +
+			`{% if isExternal %} target="_blank"{% endif %}>{{ text|safe }}</a>`,
+		"image":     `<img src="{{ destination }}" alt="{{ alt }}" title="{{ title }}">`,
+		"heading":   `<h{{ level }} data-text="{{ plainText }}">{{ text|safe }}</h{{ level }}>`,
+		"codeblock": `<pre data-lang="{{ language }}">{{ code }}</pre>{% if highlighted %}HL{% endif %}`,
+	}
+
+	tests := []struct {
+		Name   string
+		Hooks  []string
+		Expect []string
+	}{
+		{
+			Name: "no hooks",
+			Expect: []string{
+				`<h1>Hello <em>world</em></h1>`,
+				`<a href="/index.html">home</a> <a href="https://example.com" title="Ex">ext</a>`,
+				`<img src="/me.png" alt="me" title="Me">`,
+				`<pre style=`,
+				`<pre><code>indented`,
+			},
+		},
+		{
+			Name:  "all hooks",
+			Hooks: []string{"link", "image", "heading", "codeblock"},
+			Expect: []string{
+				`<h1 data-text="Hello world">Hello <em>world</em></h1>`,
+				`<a href="/index.html" title="">home</a> ` +
+					`<a href="https://example.com" title="Ex" target="_blank">ext</a>`,
+				`<img src="/me.png" alt="me" title="Me">`,
+				"<pre data-lang=\"go\">x := 1\n</pre>HL",
+				"HL<pre data-lang=\"\">indented\n</pre>",
+			},
+		},
+		{
+			Name:  "some hooks",
+			Hooks: []string{"link", "codeblock"},
+			Expect: []string{
+				`<h1>Hello <em>world</em></h1>`,
+				`<a href="/index.html" title="">home</a> ` +
+					`<a href="https://example.com" title="Ex" target="_blank">ext</a>`,
+				`<img src="/me.png" alt="me" title="Me">`,
+				"<pre data-lang=\"go\">x := 1\n</pre>HL",
+				"HL<pre data-lang=\"\">indented\n</pre>",
+			},
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			files := map[string]string{
+				"includes/page.html": "{{ content|safe }}",
+				"pages/index.md":     page,
+				"public/.keep":       "",
+			}
+			for _, name := range tcase.Hooks {
+				files["includes/"+HooksDir+"/"+name+".html"] = hooks[name]
+			}
+			chdirSite(t, files)
+
+			c := newTestSiteConfig()
+			out := NewMemFS()
+			c.OutputFS = out
+
+			b, err := New(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fb, err := out.ReadFile(filepath.Join("build", "index.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range tcase.Expect {
+				if !strings.Contains(string(fb), e) {
+					t.Errorf("expected %q in %q", e, fb)
+				}
+			}
+		})
+	}
+}
+
+func TestCodeBlockHookTemplating(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html":                       "{{ content|safe }}",
+		"includes/" + HooksDir + "/codeblock.html": `<div class="code">{{ code }}</div>`,
+		"pages/index.md":                           "{{ 'hi'|upper }}\n\n```\n{{ title }} {% if true %}yes{% endif %}\n```\n",
+		"public/.keep":                             "",
+	})
+
+	c := newTestSiteConfig()
+	out := NewMemFS()
+	c.OutputFS = out
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fb, err := out.ReadFile(filepath.Join("build", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "<p>HI</p>\n<div class=\"code\">{{ title }} {% if true %}yes{% endif %}\n</div>"
+	if got := strings.TrimSpace(string(fb)); got != expect {
+		t.Errorf("expected %q but got %q", expect, got)
+	}
+}
@@ -0,0 +1,53 @@
+package builder
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// chromaStyles are the CSS properties that chroma uses when it highlights
+// code with inline styles instead of classes.
+var chromaStyles = []string{
+	"color",
+	"background-color",
+	"font-weight",
+	"font-style",
+	"text-decoration",
+	"display",
+	"width",
+	"margin",
+	"margin-right",
+	"padding",
+	"padding-right",
+	"border",
+	"overflow-x",
+	"tab-size",
+	"-moz-tab-size",
+}
+
+// chromaStyleValue matches the values chroma uses for chromaStyles.
+var chromaStyleValue = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[\w\s.%-]+)$`)
+
+// newPolicy returns the policy used to sanitize rendered markdown. It is
+// based on bluemonday's UGC policy, which is suitable for user generated
+// content, and additionally permits the markup produced by chroma. The
+// elements and attributes given are allowed on top of that.
+func newPolicy(elements, attrs []string) *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// Keep classes and inline styles from syntax highlighting
+	p.AllowAttrs("class").Globally()
+	p.AllowStyles(chromaStyles...).Matching(chromaStyleValue).OnElements("pre", "code", "span", "div", "table", "td")
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\w-]+$`)).Globally()
+
+	if len(elements) > 0 {
+		p.AllowElements(elements...)
+	}
+
+	if len(attrs) > 0 {
+		p.AllowAttrs(attrs...).Globally()
+	}
+
+	return p
+}
@@ -0,0 +1,93 @@
+package builder
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html": "{{ content|safe }}",
+		"pages/index.md": "# Title\n\n" +
+			"<script>alert(1)</script>\n\n" +
+			"<iframe src=\"https://example.com\"></iframe>\n\n" +
+			"<p class=\"note\" data-x=\"1\" onclick=\"x()\">hi</p>\n\n" +
+			"```go\nx := 1\n```\n",
+		"public/.keep": "",
+	})
+
+	tests := []struct {
+		Name       string
+		Safe       bool
+		Sanitize   bool
+		Elements   []string
+		Attributes []string
+		Expect     string
+	}{
+		{
+			Name: "safe",
+			Safe: true,
+			Expect: "<h1>Title</h1>\n" +
+				"<!-- raw HTML omitted -->\n<!-- raw HTML omitted -->\n<!-- raw HTML omitted -->\n" +
+				"<pre style=\"color:#e5e5e5;background-color:#000\">x := <span style=\"color:#ff0;font-weight:bold\">1</span>\n</pre>",
+		},
+		{
+			Name: "unsafe",
+			Expect: "<h1>Title</h1>\n" +
+				"<script>alert(1)</script>\n" +
+				"<iframe src=\"https://example.com\"></iframe>\n" +
+				"<p class=\"note\" data-x=\"1\" onclick=\"x()\">hi</p>\n" +
+				"<pre style=\"color:#e5e5e5;background-color:#000\">x := <span style=\"color:#ff0;font-weight:bold\">1</span>\n</pre>",
+		},
+		{
+			Name:     "unsafe and sanitized",
+			Sanitize: true,
+			Expect: "<h1>Title</h1>\n\n\n" +
+				"<p class=\"note\">hi</p>\n" +
+				"<pre style=\"color: #e5e5e5; background-color: #000\">x := <span style=\"color: #ff0; font-weight: bold\">1</span>\n</pre>",
+		},
+		{
+			Name:       "sanitized with allowed elements and attributes",
+			Sanitize:   true,
+			Elements:   []string{"iframe"},
+			Attributes: []string{"data-x", "src"},
+			Expect: "<h1>Title</h1>\n\n" +
+				"<iframe src=\"https://example.com\"></iframe>\n" +
+				"<p class=\"note\" data-x=\"1\">hi</p>\n" +
+				"<pre style=\"color: #e5e5e5; background-color: #000\">x := <span style=\"color: #ff0; font-weight: bold\">1</span>\n</pre>",
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			c := newTestSiteConfig()
+			c.MarkdownSafe = tcase.Safe
+			c.Sanitize = tcase.Sanitize
+			c.SanitizeElements = tcase.Elements
+			c.SanitizeAttributes = tcase.Attributes
+
+			out := NewMemFS()
+			c.OutputFS = out
+
+			b, err := New(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fb, err := out.ReadFile(filepath.Join("build", "index.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.TrimSpace(string(fb)); got != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, got)
+			}
+		})
+	}
+}
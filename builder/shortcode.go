@@ -0,0 +1,346 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/flosch/pongo2/v4"
+	"gopkg.in/yaml.v2"
+)
+
+var errUnknownShortcode = errors.New("unknown shortcode")
+
+// ShortcodesDir is the directory inside the includes directory that
+// contains shortcode templates.
+const ShortcodesDir = "shortcodes"
+
+var (
+	// shortcodeRegexp matches shortcode tags like {{< name key="val" >}},
+	// {{< name />}}, and {{< /name >}}.
+	shortcodeRegexp = regexp.MustCompile(`\{\{<\s*(/?)([\w-]+)((?:\s+[\w-]+=(?:"[^"]*"|'[^']*'|[^\s"'/>]+))*)\s*(/?)>\}\}`)
+	// shortcodeParamRegexp matches a single key="val" pair.
+	shortcodeParamRegexp = regexp.MustCompile(`([\w-]+)=(?:"([^"]*)"|'([^']*)'|([^\s"'/>]+))`)
+	// fenceRegexp matches the opening or closing line of a fenced code block.
+	fenceRegexp = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+// shortcode is a shortcode found in a markdown source. start and end are
+// the offsets of the whole shortcode, including its closing tag, if any.
+type shortcode struct {
+	name   string
+	params map[string]string
+	inner  []byte
+	start  int
+	end    int
+}
+
+// parseShortcodes finds all top-level shortcodes in src. Shortcodes inside
+// code blocks and code spans are ignored. A shortcode has inner content when a
+// matching closing tag follows it.
+func parseShortcodes(src []byte) []*shortcode {
+	masked := maskCode(src)
+	locs := shortcodeRegexp.FindAllSubmatchIndex(masked, -1)
+
+	var codes []*shortcode
+
+	for i := 0; i < len(locs); i++ {
+		loc := locs[i]
+		name := string(src[loc[4]:loc[5]])
+
+		// Stray closing tags are left as they are
+		if loc[3] > loc[2] {
+			continue
+		}
+
+		sc := &shortcode{
+			name:   name,
+			params: parseShortcodeParams(src[loc[6]:loc[7]]),
+			start:  loc[0],
+			end:    loc[1],
+		}
+		codes = append(codes, sc)
+
+		// Self-closing tags have no inner content
+		if loc[9] > loc[8] {
+			continue
+		}
+
+		// Look for the matching closing tag, taking nested shortcodes
+		// with the same name into account
+		depth := 0
+		for j := i + 1; j < len(locs); j++ {
+			next := locs[j]
+			if string(src[next[4]:next[5]]) != name || next[9] > next[8] {
+				continue
+			}
+
+			if next[3] == next[2] {
+				depth++
+				continue
+			}
+
+			if depth > 0 {
+				depth--
+				continue
+			}
+
+			sc.inner = src[loc[1]:next[0]]
+			sc.end = next[1]
+			i = j
+
+			break
+		}
+
+		// Skip shortcodes nested in the inner content. They are expanded
+		// when the inner content is expanded.
+		for i+1 < len(locs) && locs[i+1][0] < sc.end {
+			i++
+		}
+	}
+
+	return codes
+}
+
+func parseShortcodeParams(src []byte) map[string]string {
+	params := make(map[string]string)
+
+	for _, m := range shortcodeParamRegexp.FindAllSubmatch(src, -1) {
+		switch {
+		case m[2] != nil:
+			params[string(m[1])] = string(m[2])
+		case m[3] != nil:
+			params[string(m[1])] = string(m[3])
+		default:
+			params[string(m[1])] = string(m[4])
+		}
+	}
+
+	return params
+}
+
+// maskCode returns a copy of src where fenced code blocks, indented code
+// blocks, and code spans are replaced with spaces, so that offsets in the
+// result are the same as in src. An indented block is recognized when it
+// follows a blank line, which is an approximation of the markdown rules
+// that ignores indented content of list items.
+func maskCode(src []byte) []byte {
+	masked := make([]byte, len(src))
+	copy(masked, src)
+
+	mask := func(start, end int) {
+		for i := start; i < end; i++ {
+			if masked[i] != '\n' {
+				masked[i] = ' '
+			}
+		}
+	}
+
+	fence := ""
+	indented := false
+	blank := true
+	offset := 0
+
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		m := fenceRegexp.FindSubmatch(line)
+		isBlank := len(bytes.TrimSpace(line)) == 0
+
+		switch {
+		case fence != "":
+			if m != nil && strings.HasPrefix(string(m[1]), fence) &&
+				len(bytes.TrimSpace(line)) == len(m[1]) {
+				fence = ""
+			}
+			mask(offset, offset+len(line))
+		case m != nil:
+			fence = string(m[1])
+			indented = false
+			mask(offset, offset+len(line))
+		case isIndentedCode(line) && (blank || indented):
+			indented = true
+			mask(offset, offset+len(line))
+		case !isBlank:
+			indented = false
+		}
+
+		blank = isBlank
+		offset += len(line)
+	}
+
+	maskCodeSpans(masked, mask)
+
+	return masked
+}
+
+// isIndentedCode reports whether line is indented enough to be a line of
+// an indented code block.
+func isIndentedCode(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("    ")) || bytes.HasPrefix(line, []byte("\t"))
+}
+
+// maskCodeSpans calls mask with the offsets of each code span in src. A
+// code span starts with a run of backticks and ends with the next run of
+// the same length, and may span lines.
+func maskCodeSpans(src []byte, mask func(start, end int)) {
+	for i := 0; i < len(src); {
+		if src[i] != '`' || (i > 0 && src[i-1] == '\\') {
+			i++
+			continue
+		}
+
+		n := countBackticks(src[i:])
+		end := -1
+
+		for j := i + n; j < len(src); {
+			if src[j] != '`' {
+				j++
+				continue
+			}
+
+			m := countBackticks(src[j:])
+			if m == n {
+				end = j + m
+				break
+			}
+
+			j += m
+		}
+
+		if end < 0 {
+			// An unmatched run of backticks is literal text
+			i += n
+			continue
+		}
+
+		mask(i, end)
+		i = end
+	}
+}
+
+func countBackticks(src []byte) int {
+	n := 0
+	for n < len(src) && src[n] == '`' {
+		n++
+	}
+
+	return n
+}
+
+// splitFrontMatter splits the markdown source src into its front matter,
+// including the separator lines, and the rest. Shortcodes are not expanded
+// in front matter.
+func splitFrontMatter(src []byte) ([]byte, []byte) {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	if !isFrontMatterSeparator(lines[0]) {
+		return nil, src
+	}
+
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		offset += len(line)
+
+		if isFrontMatterSeparator(line) {
+			return src[:offset], src[offset:]
+		}
+	}
+
+	return nil, src
+}
+
+// parseFrontMatter decodes the YAML between the separators of fm, as
+// returned by splitFrontMatter.
+func parseFrontMatter(fm []byte) (map[string]interface{}, error) {
+	meta := make(map[string]interface{})
+
+	lines := bytes.SplitAfter(bytes.TrimRight(fm, "\n"), []byte("\n"))
+	if len(lines) < 2 {
+		return meta, nil
+	}
+
+	src := bytes.Join(lines[1:len(lines)-1], nil)
+	if err := yaml.Unmarshal(src, &meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// isFrontMatterSeparator reports whether line is a line of dashes, which
+// opens and closes front matter.
+func isFrontMatterSeparator(line []byte) bool {
+	line = bytes.TrimSpace(line)
+
+	return len(line) > 0 && len(bytes.Trim(line, "-")) == 0
+}
+
+// expandShortcodes replaces the shortcodes in src with placeholders and
+// returns the result, along with the rendered output of each shortcode
+// keyed by its placeholder. Placeholders are plain words so that they
+// survive markdown rendering and are substituted with replaceShortcodes.
+func (b *Builder) expandShortcodes(src []byte, publicAssets map[string]string) ([]byte, map[string]string, error) {
+	rendered := make(map[string]string)
+	out := new(bytes.Buffer)
+	last := 0
+
+	for i, sc := range parseShortcodes(src) {
+		s, err := b.renderShortcode(sc, publicAssets)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key := fmt.Sprintf("yagssshortcode%dx", i)
+		rendered[key] = s
+
+		out.Write(src[last:sc.start])
+		out.WriteString(key)
+		last = sc.end
+	}
+
+	out.Write(src[last:])
+
+	// Escaped shortcodes like {{</* name */>}} are output literally
+	res := bytes.ReplaceAll(out.Bytes(), []byte("{{</*"), []byte("{{<"))
+	res = bytes.ReplaceAll(res, []byte("*/>}}"), []byte(">}}"))
+
+	return res, rendered, nil
+}
+
+func (b *Builder) renderShortcode(sc *shortcode, publicAssets map[string]string) (string, error) {
+	tplP := ShortcodesDir + "/" + sc.name + ".html"
+
+	tpl, err := b.fromFile(tplP)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %s", errUnknownShortcode, sc.name, err.Error())
+	}
+
+	// Nested shortcodes are rendered in place
+	inner, rendered, err := b.expandShortcodes(sc.inner, publicAssets)
+	if err != nil {
+		return "", err
+	}
+
+	s, err := b.execute(tpl, pongo2.Context{
+		"params": sc.params,
+		"inner":  replaceShortcodes(string(inner), rendered),
+		"assets": publicAssets,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not render shortcode %q: %w", sc.name, err)
+	}
+
+	return s, nil
+}
+
+// replaceShortcodes substitutes the placeholders in s with the rendered
+// shortcodes. A placeholder that was rendered as a paragraph of its own is
+// replaced along with the paragraph tags.
+func replaceShortcodes(s string, rendered map[string]string) string {
+	for key, val := range rendered {
+		s = strings.ReplaceAll(s, "<p>"+key+"</p>", val)
+		s = strings.ReplaceAll(s, key, val)
+	}
+
+	return s
+}
@@ -0,0 +1,169 @@
+package builder
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseShortcodes(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Src    string
+		Expect []shortcode
+	}{
+		{
+			Name:   "no shortcodes",
+			Src:    "Hello {{ title }}",
+			Expect: nil,
+		},
+		{
+			Name: "params",
+			Src:  `a {{< youtube id="abc" start='10' autoplay=true >}} b`,
+			Expect: []shortcode{{
+				name:   "youtube",
+				params: map[string]string{"id": "abc", "start": "10", "autoplay": "true"},
+				start:  2,
+				end:    51,
+			}},
+		},
+		{
+			Name: "inner content",
+			Src:  `{{< callout >}}Be *careful*{{< /callout >}}`,
+			Expect: []shortcode{{
+				name:   "callout",
+				params: map[string]string{},
+				inner:  []byte("Be *careful*"),
+				start:  0,
+				end:    43,
+			}},
+		},
+		{
+			Name: "nested",
+			Src:  `{{< box >}}{{< box />}}{{< box >}}x{{< /box >}}{{< /box >}}`,
+			Expect: []shortcode{{
+				name:   "box",
+				params: map[string]string{},
+				inner:  []byte(`{{< box />}}{{< box >}}x{{< /box >}}`),
+				start:  0,
+				end:    59,
+			}},
+		},
+		{
+			Name:   "fenced code",
+			Src:    "```\n{{< youtube id=\"abc\" >}}\n```\n",
+			Expect: nil,
+		},
+		{
+			Name:   "indented code",
+			Src:    "Text\n\n    {{< youtube id=\"abc\" >}}\n",
+			Expect: nil,
+		},
+		{
+			Name: "indented paragraph continuation",
+			Src:  "Text\n    {{< youtube />}}\n",
+			Expect: []shortcode{{
+				name:   "youtube",
+				params: map[string]string{},
+				start:  9,
+				end:    25,
+			}},
+		},
+		{
+			Name:   "code span",
+			Src:    "Use `{{< youtube id=\"abc\" >}}` to embed",
+			Expect: nil,
+		},
+		{
+			Name:   "code span with double backticks",
+			Src:    "``{{< youtube />}} ` ``",
+			Expect: nil,
+		},
+		{
+			Name: "unmatched backtick",
+			Src:  "` {{< youtube />}}",
+			Expect: []shortcode{{
+				name:   "youtube",
+				params: map[string]string{},
+				start:  2,
+				end:    18,
+			}},
+		},
+		{
+			Name:   "escaped",
+			Src:    `{{</* youtube id="abc" */>}}`,
+			Expect: nil,
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			codes := parseShortcodes([]byte(tcase.Src))
+			if len(codes) != len(tcase.Expect) {
+				t.Fatalf("expected %d shortcodes but got %d", len(tcase.Expect), len(codes))
+			}
+
+			for i := range codes {
+				if !reflect.DeepEqual(*codes[i], tcase.Expect[i]) {
+					t.Errorf("expected %+v but got %+v", tcase.Expect[i], *codes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRenderShortcodes(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html":           "{{ title|safe }}|{{ content|safe }}",
+		"includes/shortcodes/box.html": `<div class="box">{{ inner|safe }}</div>`,
+		"pages/about.md": "---\ntitle: \"{{< box />}}\"\n---\n" +
+			"{{< box >}}hi <script>alert(1)</script>{{< /box >}}\n",
+		"public/.keep": "",
+	})
+
+	tests := []struct {
+		Name     string
+		Sanitize bool
+		Expect   string
+	}{
+		{
+			Name:   "not sanitized",
+			Expect: `{{< box />}}|<div class="box">hi <script>alert(1)</script></div>`,
+		},
+		{
+			Name:     "sanitized",
+			Sanitize: true,
+			Expect:   `{{< box />}}|<div class="box">hi </div>`,
+		},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			c := newTestSiteConfig()
+			c.Sanitize = tcase.Sanitize
+
+			out := NewMemFS()
+			c.OutputFS = out
+
+			b, err := New(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fb, err := out.ReadFile(filepath.Join("build", "about.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.TrimSpace(string(fb)); got != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package builder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+var (
+	errFilterExists = errors.New("filter is already registered with pongo2")
+	errNoBuilder    = errors.New("not executed by a Builder")
+)
+
+// Filters and tags are global in pongo2 and are looked up when a template
+// is compiled. Each filter name of Builders is registered with pongo2 once,
+// as a function that calls the filter of the Builder that executes the
+// template. Filters registered by pongo2 or by the program are never
+// replaced.
+var (
+	registerMu sync.Mutex
+	registered = make(map[string]bool)
+)
+
+// registerFilter registers the filter name of Builders with pongo2. It
+// returns errFilterExists if another filter has the name.
+func registerFilter(name string) error {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+
+	if registered[name] {
+		return nil
+	}
+
+	if pongo2.FilterExists(name) {
+		return fmt.Errorf("%w: %q", errFilterExists, name)
+	}
+
+	err := pongo2.RegisterFilter(name, func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		b := executing.builder()
+		if b == nil {
+			return nil, filterError(name, errNoBuilder)
+		}
+
+		fn, ok := b.filters[name]
+		if !ok {
+			return nil, filterError(name, fmt.Errorf("filter %q does not exist", name))
+		}
+
+		return fn(in, param)
+	})
+	if err != nil {
+		return fmt.Errorf("could not register filter %q: %w", name, err)
+	}
+
+	registered[name] = true
+
+	return nil
+}
+
+// registerTagsOnce registers the tags of Builders with pongo2. Like filters,
+// tags look up the executing Builder. If the program registered a tag of
+// the same name, templates use that tag.
+var registerTagsOnce sync.Once
+
+// initTemplateFuncs sets up the built-in and plugin filters and the tags of
+// the Builder. Built-in filters whose names are taken by pongo2 or the
+// program are left out, so that templates use the existing filters.
+func (b *Builder) initTemplateFuncs() error {
+	registerTagsOnce.Do(func() {
+		_ = pongo2.RegisterTag("image", parseImageTag)
+	})
+
+	b.filters = b.builtinFilters()
+
+	for name := range b.filters {
+		err := registerFilter(name)
+		if errors.Is(err, errFilterExists) {
+			delete(b.filters, name)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.addPluginFilters()
+}
+
+// executing holds the Builders whose templates are executing. pongo2
+// executes templates on the calling goroutine but does not pass the
+// execution context to filters, so filters look up the Builder of the
+// goroutine they run on. Builders execute templates concurrently.
+var executing = &executionScope{builders: make(map[uint64][]*Builder)}
+
+type executionScope struct {
+	mu sync.RWMutex
+	// builders maps goroutines to the Builders whose templates they
+	// execute, innermost last
+	builders map[uint64][]*Builder
+}
+
+// enter makes b the executing Builder of the calling goroutine.
+func (s *executionScope) enter(b *Builder) {
+	id := goroutineID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.builders[id] = append(s.builders[id], b)
+}
+
+// leave ends a template execution started with enter on the same
+// goroutine.
+func (s *executionScope) leave() {
+	id := goroutineID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stack := s.builders[id]; len(stack) > 1 {
+		s.builders[id] = stack[:len(stack)-1]
+	} else {
+		delete(s.builders, id)
+	}
+}
+
+// builder returns the executing Builder of the calling goroutine, or nil.
+func (s *executionScope) builder() *Builder {
+	id := goroutineID()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stack := s.builders[id]
+	if len(stack) == 0 {
+		return nil
+	}
+
+	return stack[len(stack)-1]
+}
+
+// goroutineID returns the ID of the calling goroutine, which the runtime
+// prints at the start of its stack trace as "goroutine <id> [".
+func goroutineID() uint64 {
+	var buf [64]byte
+
+	fields := bytes.Fields(buf[:runtime.Stack(buf[:], false)])
+	if len(fields) < 2 {
+		return 0
+	}
+
+	id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+
+	return id
+}
+
+// execute executes tpl with ctx. Filters and tags in tpl, including in
+// templates it includes, resolve to the Builder.
+func (b *Builder) execute(tpl *pongo2.Template, ctx pongo2.Context) (string, error) {
+	executing.enter(b)
+	defer executing.leave()
+
+	return tpl.Execute(ctx)
+}
+
+// templateDepRegexp matches tags that compile other template files into a
+// template when it is compiled.
+var templateDepRegexp = regexp.MustCompile(`\{%-?\s*(?:extends|include|import|ssi)\s+(?:"([^"]+)"|'([^']+)')`)
+
+// templateCache caches compiled templates across builds. Templates are
+// keyed by the hash of their source and are recompiled when a template
+// file they extend, include, or import changes.
+type templateCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedTemplate
+	// files holds the template files read during the current build, so
+	// that each file is read at most once per build. Files that could not
+	// be read are nil.
+	files map[string]*templateFile
+	// used holds the keys of the templates used during the current build
+	used map[string]bool
+}
+
+type cachedTemplate struct {
+	tpl *pongo2.Template
+	// deps maps the names of the template files that were compiled into
+	// the template to their hashes at the time
+	deps map[string]string
+}
+
+type templateFile struct {
+	content []byte
+	hash    string
+}
+
+func newTemplateCache() *templateCache {
+	c := &templateCache{entries: make(map[string]*cachedTemplate)}
+	c.reset()
+
+	return c
+}
+
+// reset forgets the template files read during the previous build, so that
+// changed files are read again.
+func (c *templateCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files = make(map[string]*templateFile)
+	c.used = make(map[string]bool)
+}
+
+// sweep removes the templates that were not used during the current build.
+func (c *templateCache) sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if !c.used[key] {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// templateFile returns the template file name in the includes dir, or nil
+// if it can not be read. c.mu must be held.
+func (b *Builder) templateFile(name string) *templateFile {
+	c := b.tplCache
+
+	f, ok := c.files[name]
+	if ok {
+		return f
+	}
+
+	fb, err := ioutil.ReadFile(filepath.Join(b.config.TemplatesDir, filepath.FromSlash(name)))
+	if err == nil {
+		f = &templateFile{content: fb, hash: contentKey(fb)}
+	}
+
+	c.files[name] = f
+
+	return f
+}
+
+// templateDeps adds the template files that src compiles in and the files
+// that they compile in to deps. c.mu must be held.
+func (b *Builder) templateDeps(src []byte, deps map[string]string) {
+	for _, m := range templateDepRegexp.FindAllSubmatch(src, -1) {
+		name := string(m[1]) + string(m[2])
+		if _, ok := deps[name]; ok {
+			continue
+		}
+
+		f := b.templateFile(name)
+		if f == nil {
+			deps[name] = ""
+			continue
+		}
+
+		deps[name] = f.hash
+		b.templateDeps(f.content, deps)
+	}
+}
+
+// cached returns the template with key from the cache. If the template is
+// not cached or a template file compiled into it changed, it is compiled
+// from src with fn and cached.
+func (b *Builder) cached(key string, src []byte, fn func() (*pongo2.Template, error)) (*pongo2.Template, error) {
+	c := b.tplCache
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.used[key] = true
+
+	if e, ok := c.entries[key]; ok && b.depsUnchanged(e.deps) {
+		return e.tpl, nil
+	}
+
+	tpl, err := fn()
+	if err != nil {
+		delete(c.entries, key)
+		return nil, err
+	}
+
+	deps := make(map[string]string)
+	b.templateDeps(src, deps)
+
+	c.entries[key] = &cachedTemplate{tpl: tpl, deps: deps}
+
+	return tpl, nil
+}
+
+// depsUnchanged reports whether the template files in deps have the same
+// hashes as they had. c.mu must be held.
+func (b *Builder) depsUnchanged(deps map[string]string) bool {
+	for name, hash := range deps {
+		f := b.templateFile(name)
+		if f == nil && hash != "" || f != nil && f.hash != hash {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contentKey returns the hash of content used as a cache key.
+func contentKey(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// fromString compiles the template tpl in the template set of the Builder.
+func (b *Builder) fromString(tpl string) (*pongo2.Template, error) {
+	return b.fromBytes([]byte(tpl))
+}
+
+// fromBytes compiles the template tpl in the template set of the Builder.
+func (b *Builder) fromBytes(tpl []byte) (*pongo2.Template, error) {
+	fn := func() (*pongo2.Template, error) {
+		return b.templates.FromBytes(tpl)
+	}
+
+	if b.tplCache == nil {
+		return fn()
+	}
+
+	return b.cached("string:"+contentKey(tpl), tpl, fn)
+}
+
+// fromFile compiles the template file at path in the includes dir.
+func (b *Builder) fromFile(path string) (*pongo2.Template, error) {
+	fn := func() (*pongo2.Template, error) {
+		return b.templates.FromFile(path)
+	}
+
+	if b.tplCache == nil {
+		return fn()
+	}
+
+	b.tplCache.mu.Lock()
+	f := b.templateFile(path)
+	b.tplCache.mu.Unlock()
+
+	// Let pongo2 report files that can not be read
+	if f == nil {
+		return fn()
+	}
+
+	return b.cached("file:"+path+":"+f.hash, f.content, fn)
+}
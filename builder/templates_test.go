@@ -0,0 +1,323 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flosch/pongo2/v4"
+)
+
+func TestBuildersHaveOwnFilters(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/page.html": "{{ content|safe }}",
+		"includes/base.html": "{{ '/x.html'|absurl }}",
+		"pages/index.html":   "{% include 'base.html' %};{% with name='base.html' %}{% include name %}{% endwith %};{{ 'missing.css'|integrity }}",
+		"public/.keep":       "",
+	})
+
+	var builders []*Builder
+	var outs []*MemFS
+
+	for i, strict := range []bool{false, true} {
+		c := newTestSiteConfig()
+		c.SiteURL = fmt.Sprintf("https://site%d.com", i)
+		c.Strict = strict
+
+		out := NewMemFS()
+		c.OutputFS = out
+
+		b, err := New(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		builders = append(builders, b)
+		outs = append(outs, out)
+	}
+
+	// Build both sites at the same time, after both Builders are created
+	errs := make([]error, len(builders))
+
+	var wg sync.WaitGroup
+	for i, b := range builders {
+		wg.Add(1)
+
+		go func(i int, b *Builder) {
+			defer wg.Done()
+			errs[i] = b.Build()
+		}(i, b)
+	}
+	wg.Wait()
+
+	if errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+
+	index, err := outs[0].ReadFile(filepath.Join("build", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Templates that are included by name are compiled when they are
+	// executed
+	if got := strings.TrimSpace(string(index)); got != "https://site0.com/x.html;https://site0.com/x.html;" {
+		t.Errorf("expected first site to use its own site url but got %q", got)
+	}
+
+	// Only the second site is strict
+	if errs[1] == nil || !strings.Contains(errs[1].Error(), errUnknownAsset.Error()) {
+		t.Errorf("expected second site to fail with %v but got %v", errUnknownAsset, errs[1])
+	}
+}
+
+type filterPlugin struct {
+	name string
+}
+
+func (p *filterPlugin) Name() string { return "filters" }
+
+func (p *filterPlugin) TemplateFilters() map[string]pongo2.FilterFunction {
+	return map[string]pongo2.FilterFunction{p.name: filterSlugify}
+}
+
+// waitPlugin has a filter that blocks until release is closed.
+type waitPlugin struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *waitPlugin) Name() string { return "wait" }
+
+func (p *waitPlugin) TemplateFilters() map[string]pongo2.FilterFunction {
+	return map[string]pongo2.FilterFunction{
+		"test_wait": func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+			close(p.started)
+			<-p.release
+
+			return in, nil
+		},
+	}
+}
+
+func TestBuildersExecuteConcurrently(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/.keep": "",
+		"public/.keep":   "",
+	})
+
+	wait := &waitPlugin{started: make(chan struct{}), release: make(chan struct{})}
+
+	newBuilder := func(url string, plugins ...Plugin) *Builder {
+		c := newTestSiteConfig()
+		c.SiteURL = url
+
+		b, err := New(c, nil, plugins...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return b
+	}
+
+	blocked := newBuilder("https://blocked.com", wait)
+	other := newBuilder("https://other.com")
+
+	render := func(b *Builder, src string) (string, error) {
+		tpl, err := b.fromString(src)
+		if err != nil {
+			return "", err
+		}
+
+		return b.execute(tpl, nil)
+	}
+
+	type result struct {
+		out string
+		err error
+	}
+
+	blockedOut := make(chan result, 1)
+
+	go func() {
+		out, err := render(blocked, "{{ 'x'|test_wait }}{{ '/a.html'|absurl }}")
+		blockedOut <- result{out, err}
+	}()
+
+	<-wait.started
+
+	// The other Builder executes while the first one is in the middle of
+	// a template
+	otherOut := make(chan result, 1)
+
+	go func() {
+		out, err := render(other, "{{ '/b.html'|absurl }}")
+		otherOut <- result{out, err}
+	}()
+
+	select {
+	case r := <-otherOut:
+		if r.err != nil || r.out != "https://other.com/b.html" {
+			t.Errorf("expected %q but got %q, %v", "https://other.com/b.html", r.out, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the other Builder to execute while the first one is executing")
+	}
+
+	close(wait.release)
+
+	r := <-blockedOut
+	if r.err != nil || r.out != "xhttps://blocked.com/a.html" {
+		t.Errorf("expected %q but got %q, %v", "xhttps://blocked.com/a.html", r.out, r.err)
+	}
+}
+
+func TestNewKeepsPongo2Filters(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/.keep": "",
+		"public/.keep":   "",
+	})
+
+	plain := func(tpl string) (string, error) {
+		t.Helper()
+
+		p2tpl, err := pongo2.FromString(tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return p2tpl.Execute(nil)
+	}
+
+	// truncatewords_html is a filter of pongo2
+	truncate := "{{ '<p>one two</p><p>three</p>'|truncatewords_html:2 }}"
+
+	want, err := plain(truncate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = New(newTestSiteConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := plain(truncate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != want {
+		t.Errorf("expected pongo2 filter to render %q after New but got %q", want, got)
+	}
+
+	// pongo2 has no slugify filter, and the one of yagss does not work in
+	// templates that are not executed by a Builder
+	_, err = plain("{{ 'A B'|slugify }}")
+	if err == nil || !strings.Contains(err.Error(), errNoBuilder.Error()) {
+		t.Errorf("expected error %v but got %v", errNoBuilder, err)
+	}
+
+	// Filters that the program registered are not replaced
+	err = pongo2.RegisterFilter("test_program_filter", filterSlugify)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"truncatewords_html", "test_program_filter"} {
+		_, err = New(newTestSiteConfig(), nil, &filterPlugin{name: name})
+		if !errors.Is(err, errFilterExists) {
+			t.Errorf("expected plugin filter %q to fail with %v but got %v", name, errFilterExists, err)
+		}
+	}
+}
+
+func TestTemplateCache(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"includes/base.html": "{% block main %}{% endblock %}|{% include 'nav.html' %}",
+		"includes/nav.html":  "nav v1",
+		"includes/page.html": "{% extends 'base.html' %}{% block main %}{{ content|safe }}{% endblock %}",
+		"pages/about.md":     "about",
+		"public/.keep":       "",
+	})
+
+	c := newTestSiteConfig()
+	out := NewMemFS()
+	c.OutputFS = out
+
+	b, err := New(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := func() (string, *pongo2.Template) {
+		t.Helper()
+
+		err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		about, err := out.ReadFile(filepath.Join("build", "about.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b.tplCache.mu.Lock()
+		defer b.tplCache.mu.Unlock()
+
+		for key, e := range b.tplCache.entries {
+			if strings.HasPrefix(key, "file:page.html:") {
+				return strings.TrimSpace(string(about)), e.tpl
+			}
+		}
+
+		t.Fatal("expected page.html to be cached")
+
+		return "", nil
+	}
+
+	about1, tpl1 := build()
+	if about1 != "<p>about</p>\n|nav v1" {
+		t.Errorf("unexpected output %q", about1)
+	}
+
+	_, tpl2 := build()
+	if tpl1 != tpl2 {
+		t.Error("expected unchanged template to be reused")
+	}
+
+	// Change a template that is included by the template that page.html
+	// extends
+	err = ioutil.WriteFile(filepath.Join("includes", "nav.html"), []byte("nav v2"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	about3, tpl3 := build()
+	if tpl3 == tpl2 {
+		t.Error("expected template to be recompiled after an included template changed")
+	}
+
+	if about3 != "<p>about</p>\n|nav v2" {
+		t.Errorf("unexpected output %q", about3)
+	}
+
+	// Templates of the previous content of markdown files are removed from
+	// the cache
+	err = ioutil.WriteFile(filepath.Join("pages", "about.md"), []byte("changed"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build()
+
+	if n := len(b.tplCache.entries); n != 2 {
+		t.Errorf("expected 2 cached templates but got %d", n)
+	}
+}
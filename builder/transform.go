@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var errUnknownTransformer = errors.New("unknown transformer")
+
+// Transformer transforms the content of files in the public dir before
+// they are minified and hashed.
+type Transformer interface {
+	// Match reports whether the file with key should be transformed. The
+	// key is the slash separated path of the file relative to the public
+	// dir.
+	Match(key string) bool
+	// Transform returns the transformed content of the file at path.
+	Transform(path string, content []byte) ([]byte, error)
+}
+
+// partialer is implemented by Transformers that combine several files into
+// one. Files that are partials are not written to the output dir.
+type partialer interface {
+	IsPartial(key string) bool
+}
+
+// TransformConfig configures a built-in Transformer.
+type TransformConfig struct {
+	// Pattern is a glob pattern that keys must match to be transformed.
+	// Patterns without a slash are matched against file names.
+	Pattern string
+	// Use is the name of the built-in transformer.
+	Use string
+}
+
+// builtinTransformers maps the names of built-in transformers to their
+// constructors.
+var builtinTransformers = map[string]func(pattern string) Transformer{
+	"css": newCSSTransformer,
+}
+
+// newTransformer returns the built-in transformer configured by tc.
+func newTransformer(tc TransformConfig) (Transformer, error) {
+	newT, ok := builtinTransformers[tc.Use]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownTransformer, tc.Use)
+	}
+
+	return newT(tc.Pattern), nil
+}
+
+// AddTransformer adds t to the transformers that files in the public dir
+// go through. Transformers are applied in the order they are added.
+func (b *Builder) AddTransformer(t Transformer) {
+	b.transformers = append(b.transformers, t)
+}
+
+// transform applies the transformers that match key to content in order.
+func (b *Builder) transform(key, path string, content []byte) ([]byte, error) {
+	key = filepath.ToSlash(key)
+
+	for _, t := range b.transformers {
+		if !t.Match(key) {
+			continue
+		}
+
+		var err error
+		content, err = t.Transform(path, content)
+		if err != nil {
+			return nil, fmt.Errorf("could not transform %q: %w", path, err)
+		}
+	}
+
+	return content, nil
+}
+
+// isTransformed reports whether any transformer matches key.
+func (b *Builder) isTransformed(key string) bool {
+	key = filepath.ToSlash(key)
+
+	for _, t := range b.transformers {
+		if t.Match(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPartial reports whether key is a partial of a transformer that
+// matches it.
+func (b *Builder) isPartial(key string) bool {
+	key = filepath.ToSlash(key)
+
+	for _, t := range b.transformers {
+		if p, ok := t.(partialer); ok && t.Match(key) && p.IsPartial(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globMatcher matches keys against a glob pattern. Patterns without a
+// slash are matched against the last element of keys.
+type globMatcher string
+
+func (g globMatcher) Match(key string) bool {
+	pattern := string(g)
+	if !strings.Contains(pattern, "/") {
+		key = path.Base(key)
+	}
+
+	ok, err := path.Match(pattern, key)
+
+	return err == nil && ok
+}
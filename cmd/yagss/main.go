@@ -1,17 +1,38 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 
-	"github.com/AlexanderRichey/yagss/internal/builder"
+	"github.com/AlexanderRichey/yagss/builder"
+	"github.com/AlexanderRichey/yagss/internal/checker"
 	"github.com/AlexanderRichey/yagss/internal/proj"
 	"github.com/AlexanderRichey/yagss/internal/server"
 	"github.com/AlexanderRichey/yagss/internal/version"
 )
 
-var port int
+var (
+	port      int
+	strict    bool
+	noMinify  bool
+	checkOpts struct {
+		external    bool
+		format      string
+		concurrency int
+		timeout     time.Duration
+		perHost     time.Duration
+		cachePath   string
+		cacheTTL    time.Duration
+	}
+)
 
 func main() {
 	log.SetFlags(0)
@@ -44,11 +65,19 @@ func main() {
 		Long: `build the current yagss site using the config.toml file
 in the current working directory.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			c, err := builder.ReadConfig()
+			c, err := builder.ReadConfig(builder.ConfigFile)
 			if err != nil {
 				log.Fatal(err)
 			}
 
+			if strict {
+				c.Strict = true
+			}
+
+			if noMinify {
+				c.NoMinify = true
+			}
+
 			b, err := builder.New(c, nil)
 			if err != nil {
 				log.Fatal(err)
@@ -60,6 +89,54 @@ in the current working directory.`,
 			}
 		},
 	}
+	cmdBuild.Flags().BoolVar(&strict, "strict", false, "fail on unknown asset keys and broken links")
+	cmdBuild.Flags().BoolVar(&noMinify, "no-minify", false, "write output files without minifying them")
+
+	cmdCheck := &cobra.Command{
+		Use:   "check",
+		Short: "Build the current yagss site and check it for broken links",
+		Long: `build the current yagss site in strict mode and check the
+built HTML files for links and sources that do not exist. With --external,
+external links are also requested and results are cached on disk.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if checkOpts.format != "text" && checkOpts.format != "json" {
+				log.Fatalf("Unknown format %q, expected text or json", checkOpts.format)
+			}
+
+			problems, err := checkSite()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			switch checkOpts.format {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+
+				err := enc.Encode(problems)
+				if err != nil {
+					log.Fatal(err)
+				}
+			default:
+				for _, p := range problems {
+					log.Print(p)
+				}
+			}
+
+			if len(problems) > 0 {
+				log.Fatalf("Found %d problems", len(problems))
+			}
+
+			log.Print("No problems found")
+		},
+	}
+	cmdCheck.Flags().BoolVar(&checkOpts.external, "external", false, "also check external links")
+	cmdCheck.Flags().StringVar(&checkOpts.format, "format", "text", "report format, either text or json")
+	cmdCheck.Flags().IntVar(&checkOpts.concurrency, "concurrency", 8, "maximum number of concurrent requests")
+	cmdCheck.Flags().DurationVar(&checkOpts.timeout, "timeout", 10*time.Second, "timeout of each request")
+	cmdCheck.Flags().DurationVar(&checkOpts.perHost, "per-host", 500*time.Millisecond, "minimum interval between requests to the same host")
+	cmdCheck.Flags().StringVar(&checkOpts.cachePath, "cache", ".yagss-cache/links.json", "file in which the results of working links are cached")
+	cmdCheck.Flags().DurationVar(&checkOpts.cacheTTL, "cache-ttl", 24*time.Hour, "how long cached results are used")
 
 	cmdServe := &cobra.Command{
 		Use:   "serve",
@@ -67,11 +144,15 @@ in the current working directory.`,
 		Long: `serve the build directory of the current yagss site and
 rebuild when source files change`,
 		Run: func(cmd *cobra.Command, args []string) {
-			c, err := builder.ReadConfig()
+			c, err := builder.ReadConfig(builder.ConfigFile)
 			if err != nil {
 				log.Fatal(err)
 			}
 
+			if noMinify {
+				c.NoMinify = true
+			}
+
 			err = server.Start(c, port)
 			if err != nil {
 				log.Fatal(err)
@@ -79,11 +160,88 @@ rebuild when source files change`,
 		},
 	}
 	cmdServe.Flags().IntVar(&port, "port", 3000, "default port")
+	cmdServe.Flags().BoolVar(&noMinify, "no-minify", false, "write output files without minifying them")
 
 	rootCmd := &cobra.Command{Use: "yagss"}
-	rootCmd.AddCommand(cmdNew, cmdBuild, cmdServe, cmdVersion)
+	rootCmd.AddCommand(cmdNew, cmdBuild, cmdCheck, cmdServe, cmdVersion)
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// checkSite builds the current site in strict mode and checks it for
+// problems. The site is built into a temporary dir, so that the output
+// dir keeps the last regular build. Problems in built files are reported
+// as if the files were in the output dir.
+func checkSite() ([]checker.Problem, error) {
+	c, err := builder.ReadConfig(builder.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir := c.OutputDir
+
+	c.OutputDir, err = ioutil.TempDir("", "yagss-check")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary output dir: %w", err)
+	}
+	defer os.RemoveAll(c.OutputDir)
+
+	// Unminified output keeps the line numbers of problems useful
+	c.Strict = true
+	c.NoMinify = true
+
+	b, err := builder.New(c, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Strict builds report their problems after building everything, so
+	// the built site can still be checked
+	var buildProblems builder.Problems
+
+	err = b.Build()
+	if err != nil && !errors.As(err, &buildProblems) {
+		return nil, err
+	}
+
+	problems := make([]checker.Problem, 0, len(buildProblems))
+	for _, p := range buildProblems {
+		problems = append(problems, checker.Problem{Message: p.Error()})
+	}
+
+	linkProblems, err := checker.Internal(c.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	problems = append(problems, linkProblems...)
+
+	if checkOpts.external {
+		log.Print("Checking external links...")
+
+		ext := &checker.External{
+			Concurrency: checkOpts.concurrency,
+			Timeout:     checkOpts.timeout,
+			PerHost:     checkOpts.perHost,
+			CachePath:   checkOpts.cachePath,
+			CacheTTL:    checkOpts.cacheTTL,
+		}
+
+		extProblems, err := ext.Check(c.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, extProblems...)
+	}
+
+	for i, p := range problems {
+		if rel, err := filepath.Rel(c.OutputDir, p.File); p.File != "" && err == nil {
+			problems[i].File = filepath.Join(outputDir, rel)
+		}
+	}
+
+	return problems, nil
+}
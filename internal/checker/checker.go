@@ -0,0 +1,189 @@
+package checker
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// tagRegexp matches opening HTML tags.
+	tagRegexp = regexp.MustCompile(`<[a-zA-Z][^>]*>`)
+	// attrRegexp matches href, src, and srcset attributes, which may be
+	// unquoted in minified output.
+	attrRegexp = regexp.MustCompile(`\s(href|src|srcset)=(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// Problem is a broken reference found in a built file.
+type Problem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Target  string `json:"target"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	// Problems found while building have no file
+	if p.File == "" {
+		return p.Message
+	}
+
+	return fmt.Sprintf("%s:%d: %s: %q", p.File, p.Line, p.Message, p.Target)
+}
+
+// ref is a URL referenced by an attribute in an HTML file.
+type ref struct {
+	file string
+	line int
+	url  string
+}
+
+// Internal checks that the internal href and src targets of all HTML files
+// in outputDir exist in outputDir. It returns a problem for each target
+// that does not exist.
+func Internal(outputDir string) ([]Problem, error) {
+	refs, err := gatherRefs(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := make([]Problem, 0)
+
+	for _, r := range refs {
+		u, err := url.Parse(r.url)
+		if err != nil {
+			problems = append(problems, Problem{
+				File:    r.file,
+				Line:    r.line,
+				Target:  r.url,
+				Message: "invalid url",
+			})
+
+			continue
+		}
+
+		// Skip external urls, urls with schemes like mailto:, and
+		// fragment-only links
+		if u.Scheme != "" || u.Host != "" || u.Path == "" {
+			continue
+		}
+
+		var target string
+		if strings.HasPrefix(u.Path, "/") {
+			target = filepath.Join(outputDir, filepath.FromSlash(u.Path))
+		} else {
+			target = filepath.Join(filepath.Dir(r.file), filepath.FromSlash(u.Path))
+		}
+
+		if !exists(target) {
+			problems = append(problems, Problem{
+				File:    r.file,
+				Line:    r.line,
+				Target:  r.url,
+				Message: "target does not exist",
+			})
+		}
+	}
+
+	return problems, nil
+}
+
+// exists reports whether path is a file or a directory with an index.html
+// file, which is how static file servers resolve paths.
+func exists(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	if info.IsDir() {
+		return exists(filepath.Join(path, "index.html"))
+	}
+
+	return true
+}
+
+// gatherRefs returns the URLs referenced in all HTML files in dir.
+func gatherRefs(dir string) ([]ref, error) {
+	refs := make([]ref, 0)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(path) != ".html" {
+			return nil
+		}
+
+		fb, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read file %q: %w", path, err)
+		}
+
+		refs = append(refs, findRefs(path, fb)...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %q: %w", dir, err)
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].file < refs[j].file
+	})
+
+	return refs, nil
+}
+
+// findRefs returns the URLs referenced by the href, src, and srcset
+// attributes in the HTML document fb.
+func findRefs(path string, fb []byte) []ref {
+	refs := make([]ref, 0)
+	line := 1
+	last := 0
+
+	for _, tloc := range tagRegexp.FindAllIndex(fb, -1) {
+		tag := fb[tloc[0]:tloc[1]]
+		line += bytes.Count(fb[last:tloc[0]], []byte("\n"))
+		last = tloc[0]
+
+		for _, m := range attrRegexp.FindAllSubmatch(tag, -1) {
+			var val string
+			switch {
+			case m[2] != nil:
+				val = string(m[2])
+			case m[3] != nil:
+				val = string(m[3])
+			default:
+				val = string(m[4])
+			}
+
+			val = strings.TrimSpace(html.UnescapeString(val))
+			if val == "" {
+				continue
+			}
+
+			if string(m[1]) != "srcset" {
+				refs = append(refs, ref{file: path, line: line, url: val})
+				continue
+			}
+
+			// srcset is a comma separated list of urls and descriptors
+			for _, candidate := range strings.Split(val, ",") {
+				if fields := strings.Fields(candidate); len(fields) > 0 {
+					refs = append(refs, ref{file: path, line: line, url: fields[0]})
+				}
+			}
+		}
+	}
+
+	return refs
+}
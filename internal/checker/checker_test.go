@@ -0,0 +1,151 @@
+package checker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInternal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yagss-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	files := map[string]string{
+		"index.html": `<html>
+<link rel=stylesheet href=/styles.css>
+<a href="/posts/">Posts</a>
+<a href="about.html#me">About</a>
+<a href="https://example.com/missing">External</a>
+<a href="mailto:me@example.com">Mail</a>
+<img src="/missing.png" srcset="/img-400.png 400w, /img-800.png 800w">
+</html>`,
+		"about.html":       `<a href=./index.html>Home</a><a href=/nope.html>Nope</a>`,
+		"styles.css":       `body{}`,
+		"img-400.png":      ``,
+		"posts/index.html": `<a href="../about.html">About</a>`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), os.FileMode(0777))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, []byte(content), os.FileMode(0666))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := Internal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Problem{
+		{File: filepath.Join(dir, "about.html"), Line: 1, Target: "/nope.html", Message: "target does not exist"},
+		{File: filepath.Join(dir, "index.html"), Line: 7, Target: "/missing.png", Message: "target does not exist"},
+		{File: filepath.Join(dir, "index.html"), Line: 7, Target: "/img-800.png", Message: "target does not exist"},
+	}
+
+	if !reflect.DeepEqual(problems, expect) {
+		t.Errorf("expected %v but got %v", expect, problems)
+	}
+}
+
+func TestExternal(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	dir, err := ioutil.TempDir("", "yagss-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	page := fmt.Sprintf(`<a href="%[1]s/ok">ok</a>
+<a href="%[1]s/no-head">no head</a>
+<a href="%[1]s/missing">missing</a>
+<a href="%[1]s/ok">ok again</a>`, srv.URL)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(page), os.FileMode(0666))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ext := &External{
+		Client:      srv.Client(),
+		Concurrency: 2,
+		CachePath:   filepath.Join(dir, "cache", "links.json"),
+		CacheTTL:    time.Hour,
+	}
+
+	problems, err := ext.Check(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Problem{
+		{File: filepath.Join(dir, "index.html"), Line: 3, Target: srv.URL + "/missing", Message: "status 404"},
+	}
+
+	if !reflect.DeepEqual(problems, expect) {
+		t.Errorf("expected %v but got %v", expect, problems)
+	}
+
+	// The second run should only check the failing link again, with a HEAD
+	// and a GET request
+	before := atomic.LoadInt32(&requests)
+
+	problems, err = ext.Check(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(problems, expect) {
+		t.Errorf("expected %v but got %v", expect, problems)
+	}
+
+	if after := atomic.LoadInt32(&requests); after != before+2 {
+		t.Errorf("expected 2 requests but got %d", after-before)
+	}
+}
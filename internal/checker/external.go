@@ -0,0 +1,294 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// External checks the external links in a built site.
+type External struct {
+	// Client is used to make requests. If nil, a client with Timeout is
+	// used.
+	Client *http.Client
+	// Concurrency is the maximum number of requests in flight. Values
+	// less than one are treated as one.
+	Concurrency int
+	// Timeout is the timeout of the default client.
+	Timeout time.Duration
+	// PerHost is the minimum interval between requests to the same host.
+	PerHost time.Duration
+	// CachePath is the path of the file in which the results of links that
+	// work are cached. If empty, results are not cached.
+	CachePath string
+	// CacheTTL is how long cached results are used before links are
+	// checked again. Links that fail are checked on every run.
+	CacheTTL time.Duration
+}
+
+// result is the outcome of checking a single URL.
+type result struct {
+	Status  int       `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+func (r result) ok() bool {
+	return r.Error == "" && r.Status < http.StatusBadRequest
+}
+
+// Check checks that the external links of all HTML files in outputDir can
+// be fetched. It returns a problem for each link that fails.
+func (e *External) Check(outputDir string) ([]Problem, error) {
+	refs, err := gatherRefs(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group references by url so that each url is only checked once
+	byURL := make(map[string][]ref)
+	for _, r := range refs {
+		u, err := url.Parse(r.url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+
+		byURL[r.url] = append(byURL[r.url], r)
+	}
+
+	cache, err := e.readCache()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check urls without a fresh result in the cache
+	todo := make([]string, 0)
+	for u := range byURL {
+		if res, ok := cache[u]; ok && res.ok() && time.Since(res.Checked) < e.CacheTTL {
+			continue
+		}
+
+		todo = append(todo, u)
+	}
+
+	sort.Strings(todo)
+
+	// Only links that work are cached, so that failures are checked again
+	// on the next run once they are fixed or were only transient
+	results := e.checkAll(todo)
+	for u, res := range results {
+		if res.ok() {
+			cache[u] = res
+		} else {
+			delete(cache, u)
+		}
+	}
+
+	err = e.writeCache(cache)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := make([]Problem, 0)
+	for u, rs := range byURL {
+		res, ok := results[u]
+		if !ok || res.ok() {
+			continue
+		}
+
+		msg := res.Error
+		if msg == "" {
+			msg = fmt.Sprintf("status %d", res.Status)
+		}
+
+		for _, r := range rs {
+			problems = append(problems, Problem{
+				File:    r.file,
+				Line:    r.line,
+				Target:  r.url,
+				Message: msg,
+			})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+
+		return problems[i].Line < problems[j].Line
+	})
+
+	return problems, nil
+}
+
+// checkAll checks urls concurrently and returns their results.
+func (e *External) checkAll(urls []string) map[string]result {
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: e.Timeout}
+	}
+
+	workers := e.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	limiter := &hostLimiter{interval: e.PerHost, next: make(map[string]time.Time)}
+	results := make(map[string]result)
+	jobs := make(chan string)
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for u := range jobs {
+				res := check(client, limiter, u)
+
+				mu.Lock()
+				results[u] = res
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, u := range urls {
+		jobs <- u
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	return results
+}
+
+// check requests u with HEAD, falling back to GET for servers that do not
+// handle HEAD requests properly.
+func check(client *http.Client, limiter *hostLimiter, u string) result {
+	var (
+		status int
+		err    error
+	)
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		limiter.wait(u)
+
+		status, err = request(client, method, u)
+		if err == nil && status < http.StatusBadRequest {
+			break
+		}
+	}
+
+	res := result{Status: status, Checked: time.Now()}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+func request(client *http.Client, method, u string) (int, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("User-Agent", "yagss link checker")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode, nil
+}
+
+// hostLimiter spaces out requests to the same host.
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+// wait blocks until a request to the host of u may be made.
+func (l *hostLimiter) wait(u string) {
+	if l.interval <= 0 {
+		return
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[parsed.Host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[parsed.Host] = at.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(at.Sub(now))
+}
+
+func (e *External) readCache() (map[string]result, error) {
+	cache := make(map[string]result)
+
+	if e.CachePath == "" {
+		return cache, nil
+	}
+
+	fb, err := ioutil.ReadFile(e.CachePath)
+	if os.IsNotExist(err) {
+		return cache, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read cache %q: %w", e.CachePath, err)
+	}
+
+	err = json.Unmarshal(fb, &cache)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode cache %q: %w", e.CachePath, err)
+	}
+
+	return cache, nil
+}
+
+func (e *External) writeCache(cache map[string]result) error {
+	if e.CachePath == "" {
+		return nil
+	}
+
+	fb, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode cache: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(e.CachePath), os.FileMode(0777))
+	if err != nil {
+		return fmt.Errorf("could not create cache dir: %w", err)
+	}
+
+	err = ioutil.WriteFile(e.CachePath, fb, os.FileMode(0666))
+	if err != nil {
+		return fmt.Errorf("could not write cache %q: %w", e.CachePath, err)
+	}
+
+	return nil
+}
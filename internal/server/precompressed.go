@@ -0,0 +1,79 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// precompressed serves the gzip sidecars of files in dir to clients that
+// accept gzip encoding, like nginx's gzip_static. Other requests are passed
+// to next.
+func precompressed(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Resolve paths the way http.FileServer does
+		upath := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			upath = path.Join(upath, "index.html")
+		}
+
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(upath)) + ".gz")
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctype := mime.TypeByExtension(path.Ext(upath))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		http.ServeContent(w, r, upath, info.ModTime(), f)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r includes
+// gzip with a non-zero quality.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(enc, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) != 2 || kv[0] != "q" {
+				continue
+			}
+
+			if q, err := strconv.ParseFloat(kv[1], 64); err == nil && q == 0 {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrecompressed(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"index.html":    "plain",
+		"index.html.gz": "compressed",
+		"app.js":        "plain",
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), os.FileMode(0666))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := precompressed(dir, http.FileServer(http.Dir(dir)))
+
+	tests := []struct {
+		Path           string
+		AcceptEncoding string
+		Expect         string
+		Encoding       string
+	}{
+		{Path: "/", AcceptEncoding: "gzip, deflate", Expect: "compressed", Encoding: "gzip"},
+		{Path: "/index.html.gz", AcceptEncoding: "", Expect: "compressed", Encoding: ""},
+		{Path: "/", AcceptEncoding: "br", Expect: "plain", Encoding: ""},
+		{Path: "/", AcceptEncoding: "gzip;q=0", Expect: "plain", Encoding: ""},
+		{Path: "/app.js", AcceptEncoding: "gzip", Expect: "plain", Encoding: ""},
+	}
+
+	for _, tcase := range tests {
+		req := httptest.NewRequest(http.MethodGet, tcase.Path, nil)
+		req.Header.Set("Accept-Encoding", tcase.AcceptEncoding)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if body := rec.Body.String(); body != tcase.Expect {
+			t.Errorf("%s: expected body %q but got %q", tcase.Path, tcase.Expect, body)
+		}
+
+		if enc := rec.Header().Get("Content-Encoding"); enc != tcase.Encoding {
+			t.Errorf("%s: expected encoding %q but got %q", tcase.Path, tcase.Encoding, enc)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if ctype := rec.Header().Get("Content-Type"); ctype != "text/html; charset=utf-8" {
+		t.Errorf("expected html content type but got %q", ctype)
+	}
+}
@@ -15,7 +15,7 @@ import (
 
 	"gopkg.in/fsnotify.v1"
 
-	"github.com/AlexanderRichey/yagss/internal/builder"
+	"github.com/AlexanderRichey/yagss/builder"
 	"github.com/gorilla/handlers"
 )
 
@@ -70,7 +70,7 @@ func serve(c *builder.Config, port int, doneC, closeC chan bool) {
 	srv := http.Server{
 		Handler: handlers.CustomLoggingHandler(
 			ioutil.Discard,
-			http.FileServer(http.Dir(c.OutputDir)),
+			precompressed(c.OutputDir, http.FileServer(http.Dir(c.OutputDir))),
 			func(w io.Writer, params handlers.LogFormatterParams) {
 				ll.Printf("%s %q %d\n", params.Request.Method, params.Request.URL, params.StatusCode)
 			}),
@@ -126,7 +126,7 @@ func watch(c *builder.Config, b *builder.Builder, doneC, closeC chan bool) {
 				if event.Op&fsnotify.Rename == fsnotify.Rename {
 					ll.Printf("%q has been modified", event.Name)
 
-					if err := b.Build(); err != nil {
+					if err := b.BuildChanged([]string{event.Name}); err != nil {
 						ll.Printf("error during build: %v", err)
 					}
 				}
@@ -140,7 +140,12 @@ func watch(c *builder.Config, b *builder.Builder, doneC, closeC chan bool) {
 		}
 	}()
 
-	for _, v := range []string{c.PagesDir, c.PostsDir, c.PublicDir, c.TemplatesDir} {
+	dirs := []string{c.PagesDir, c.PostsDir, c.PublicDir, c.TemplatesDir}
+	if c.DataDir != "" {
+		dirs = append(dirs, c.DataDir)
+	}
+
+	for _, v := range dirs {
 		err = watcher.Add(v)
 		if err != nil {
 			ll.Panic(err)
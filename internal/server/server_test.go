@@ -10,7 +10,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/AlexanderRichey/yagss/internal/builder"
+	"github.com/AlexanderRichey/yagss/builder"
 )
 
 // TestServer pretty much just makes sure nothing is really broken.
@@ -38,7 +38,7 @@ func TestServer(t *testing.T) {
 		}
 	})
 
-	c, err := builder.ReadConfig()
+	c, err := builder.ReadConfig(builder.ConfigFile)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,59 @@
+package mini
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+)
+
+// sidecar compresses the content of a file and writes it to a separate
+// file if the content is large enough to benefit from compression.
+type sidecar struct {
+	fs      FS
+	path    string
+	minSize int
+	size    int
+	buf     *bytes.Buffer
+	gz      *gzip.Writer
+}
+
+func newSidecar(fs FS, path string, minSize int) *sidecar {
+	buf := new(bytes.Buffer)
+
+	// The best compression is worth it because files are only compressed
+	// once at build time
+	gz, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+
+	return &sidecar{fs: fs, path: path, minSize: minSize, buf: buf, gz: gz}
+}
+
+func (s *sidecar) Write(p []byte) (int, error) {
+	s.size += len(p)
+
+	return s.gz.Write(p)
+}
+
+// Close writes the sidecar file if the content is at least minSize bytes.
+func (s *sidecar) Close() error {
+	err := s.gz.Close()
+	if err != nil {
+		return fmt.Errorf("could not compress %q: %w", s.path, err)
+	}
+
+	if s.size < s.minSize {
+		return nil
+	}
+
+	f, err := s.fs.Create(s.path)
+	if err != nil {
+		return fmt.Errorf("could not create %q: %w", s.path, err)
+	}
+
+	_, err = f.Write(s.buf.Bytes())
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %q: %w", s.path, err)
+	}
+
+	return f.Close()
+}
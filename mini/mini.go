@@ -22,59 +22,252 @@ var ErrCloseMiniFile = errors.New("error closing mini file")
 // Creator can create mini.Files.
 type Creator struct {
 	mini *minify.M
+	// mimes maps file extensions to the MIME types they are minified as
+	mimes map[string]string
+	// compressible holds the extensions of files that gzip sidecars are
+	// written for
+	compressible map[string]bool
+	gzip         bool
+	gzipMinSize  int
+	fs           FS
+}
+
+// HTMLOptions configures how HTML is minified.
+type HTMLOptions struct {
+	KeepConditionalComments bool
+	KeepDefaultAttrVals     bool
+	KeepDocumentTags        bool
+	KeepEndTags             bool
+	KeepQuotes              bool
+	KeepWhitespace          bool
+}
+
+// DefaultHTMLOptions are the HTML options used unless WithHTMLOptions is
+// given.
+var DefaultHTMLOptions = HTMLOptions{
+	KeepConditionalComments: true,
+	KeepDocumentTags:        true,
+	KeepEndTags:             true,
+}
+
+// DefaultExtensions maps the extensions of files that are minified by
+// default to their MIME types.
+var DefaultExtensions = map[string]string{
+	".html":        "text/html",
+	".css":         "text/css",
+	".svg":         "image/svg+xml",
+	".js":          "application/javascript",
+	".jsx":         "application/javascript",
+	".mjs":         "application/javascript",
+	".json":        "application/json",
+	".webmanifest": "application/manifest+json",
+	".xml":         "text/xml",
+	".rss":         "application/rss+xml",
+}
+
+type options struct {
+	html        HTMLOptions
+	mimes       map[string]string
+	disabled    map[string]bool
+	off         bool
+	gzip        bool
+	gzipMinSize int
+	fs          FS
+}
+
+// Option configures a Creator.
+type Option func(*options)
+
+// WithHTMLOptions sets the options used to minify HTML.
+func WithHTMLOptions(o HTMLOptions) Option {
+	return func(opts *options) {
+		opts.html = o
+	}
+}
+
+// WithExtension minifies files with the extension ext as the MIME type
+// mime.
+func WithExtension(ext, mime string) Option {
+	return func(opts *options) {
+		opts.mimes[ext] = mime
+	}
+}
+
+// WithoutTypes disables minification of the given MIME types.
+func WithoutTypes(mimes ...string) Option {
+	return func(opts *options) {
+		for _, mime := range mimes {
+			opts.disabled[mime] = true
+		}
+	}
+}
+
+// WithFS creates files in fs instead of the filesystem of the operating
+// system.
+func WithFS(fs FS) Option {
+	return func(opts *options) {
+		opts.fs = fs
+	}
+}
+
+// WithGzip writes a gzip compressed copy of every text file of at least
+// minSize bytes next to it, with a .gz extension appended to its name.
+// Static file servers can send these files to clients that accept gzip
+// encoding without compressing them on every request.
+func WithGzip(minSize int) Option {
+	return func(opts *options) {
+		opts.gzip = true
+		opts.gzipMinSize = minSize
+	}
+}
+
+// Disabled disables minification entirely. Files are written as is.
+func Disabled() Option {
+	return func(opts *options) {
+		opts.off = true
+	}
 }
 
 // New returns a new Creator.
-func New() *Creator {
+func New(opts ...Option) *Creator {
+	o := &options{
+		html:     DefaultHTMLOptions,
+		mimes:    make(map[string]string),
+		disabled: make(map[string]bool),
+		fs:       osFS{},
+	}
+
+	for ext, mime := range DefaultExtensions {
+		o.mimes[ext] = mime
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	m := minify.New()
 	m.AddFunc("text/css", css.Minify)
 	m.Add("text/html", &html.Minifier{
-		KeepDocumentTags:        true,
-		KeepEndTags:             true,
-		KeepConditionalComments: true,
-		KeepDefaultAttrVals:     false,
-		KeepQuotes:              false,
-		KeepWhitespace:          false,
+		KeepDocumentTags:        o.html.KeepDocumentTags,
+		KeepEndTags:             o.html.KeepEndTags,
+		KeepConditionalComments: o.html.KeepConditionalComments,
+		KeepDefaultAttrVals:     o.html.KeepDefaultAttrVals,
+		KeepQuotes:              o.html.KeepQuotes,
+		KeepWhitespace:          o.html.KeepWhitespace,
 	})
 	m.AddFunc("image/svg+xml", svg.Minify)
 	m.AddFuncRegexp(regexp.MustCompile("^(application|text)/(x-)?(java|ecma)script$"), js.Minify)
 	m.AddFuncRegexp(regexp.MustCompile("[/+]json$"), json.Minify)
 	m.AddFuncRegexp(regexp.MustCompile("[/+]xml$"), xml.Minify)
 
-	return &Creator{mini: m}
+	// Only extensions whose types are enabled are minified, but all of
+	// them are text that compresses well
+	mimes := make(map[string]string)
+	compressible := map[string]bool{".txt": true}
+	for ext, mime := range o.mimes {
+		if !o.off && !o.disabled[mime] {
+			mimes[ext] = mime
+		}
+
+		compressible[ext] = true
+	}
+
+	return &Creator{
+		mini:         m,
+		mimes:        mimes,
+		compressible: compressible,
+		gzip:         o.gzip,
+		gzipMinSize:  o.gzipMinSize,
+		fs:           o.fs,
+	}
 }
 
-// File is a regular file whose content is minified as it is written if its
-// extension is one of .html, .css, .js, .jsx, .svg, .xml, or .json. Otherwise,
-// it behaves as an ordinary file.
+// FS is a filesystem in which a Creator creates files.
+type FS interface {
+	Create(path string) (io.WriteCloser, error)
+}
+
+// osFS is the FS of the operating system.
+type osFS struct{}
+
+func (osFS) Create(path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+// File is a file whose content is minified as it is written if its
+// extension is one that the Creator minifies. Otherwise, it behaves as an
+// ordinary file. If the Creator writes gzip sidecars, a compressed copy of
+// the content is written next to the file when it is closed.
 type File struct {
-	file   *os.File
+	file   io.WriteCloser
 	writer io.WriteCloser
-	isMini bool
+	gz     *sidecar
 }
 
 // Create creates a new mini.File.
 func (m *Creator) Create(path string) (*File, error) {
-	f, err := os.Create(path)
+	f, err := m.create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f.writer = m.Wrap(f.writer, path)
+
+	return f, nil
+}
+
+// CreateRaw creates a new mini.File whose content is written as is. It is
+// meant for content that has already been minified with Bytes.
+func (m *Creator) CreateRaw(path string) (*File, error) {
+	return m.create(path)
+}
+
+func (m *Creator) create(path string) (*File, error) {
+	f, err := m.fs.Create(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not create mini file %q: %w", path, err)
 	}
 
-	if mime, ok := getMIME(path); ok {
-		w := m.mini.Writer(mime, f)
+	mf := &File{file: f, writer: nopCloser{f}}
 
-		return &File{file: f, writer: w, isMini: true}, nil
+	if m.gzip && m.compressible[filepath.Ext(path)] {
+		mf.gz = newSidecar(m.fs, path+".gz", m.gzipMinSize)
+		mf.writer = nopCloser{io.MultiWriter(f, mf.gz)}
 	}
 
-	return &File{file: f, isMini: false}, nil
+	return mf, nil
 }
 
-func (f *File) Write(p []byte) (int, error) {
-	if f.isMini {
-		return f.writer.Write(p)
+// Wrap returns a writer that minifies the content written to it according
+// to the extension of path and writes the result to w. If the extension is
+// not one that is minified, content is written to w as is. The writer must
+// be closed to flush the minified content, which does not close w.
+func (m *Creator) Wrap(w io.Writer, path string) io.WriteCloser {
+	if mime, ok := m.getMIME(path); ok {
+		return m.mini.Writer(mime, w)
+	}
+
+	return nopCloser{w}
+}
+
+// Bytes returns b minified according to the extension of path. If the
+// extension is not one that is minified, b is returned as is.
+func (m *Creator) Bytes(path string, b []byte) ([]byte, error) {
+	mime, ok := m.getMIME(path)
+	if !ok {
+		return b, nil
 	}
 
-	return f.file.Write(p)
+	out, err := m.mini.Bytes(mime, b)
+	if err != nil {
+		return nil, fmt.Errorf("could not minify %q: %w", path, err)
+	}
+
+	return out, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	return f.writer.Write(p)
 }
 
 func (f *File) Close() error {
@@ -83,8 +276,11 @@ func (f *File) Close() error {
 		err2 error
 	)
 
-	if f.isMini {
-		err1 = f.writer.Close()
+	err1 = f.writer.Close()
+
+	// The sidecar is only complete once the minifier has been flushed
+	if f.gz != nil && err1 == nil {
+		err1 = f.gz.Close()
 	}
 
 	err2 = f.file.Close()
@@ -100,21 +296,16 @@ func (f *File) Close() error {
 	return nil
 }
 
-func getMIME(path string) (mime string, ok bool) {
-	switch filepath.Ext(path) {
-	case ".html":
-		return "text/html", true
-	case ".css":
-		return "text/css", true
-	case ".svg":
-		return "image/svg+xml", true
-	case ".js", ".jsx":
-		return "application/javascript", true
-	case ".json":
-		return "application/json", true
-	case ".xml":
-		return "text/xml", true
-	default:
-		return "", false
-	}
+func (m *Creator) getMIME(path string) (mime string, ok bool) {
+	mime, ok = m.mimes[filepath.Ext(path)]
+
+	return mime, ok
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
 }
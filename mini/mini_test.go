@@ -0,0 +1,112 @@
+package mini
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	input := []byte("<p>  a  </p>\n<p class=\"x\">b</p>")
+
+	tests := []struct {
+		Name   string
+		Path   string
+		Opts   []Option
+		Expect string
+	}{
+		{Name: "default", Path: "a.html", Expect: "<p>a</p><p class=x>b</p>"},
+		{Name: "keep quotes", Path: "a.html", Opts: []Option{WithHTMLOptions(HTMLOptions{KeepQuotes: true})},
+			Expect: "<p>a<p class=\"x\">b"},
+		{Name: "type disabled", Path: "a.html", Opts: []Option{WithoutTypes("text/html")}, Expect: string(input)},
+		{Name: "disabled", Path: "a.html", Opts: []Option{Disabled()}, Expect: string(input)},
+		{Name: "unknown extension", Path: "a.tpl", Expect: string(input)},
+		{Name: "added extension", Path: "a.tpl", Opts: []Option{WithExtension(".tpl", "text/html")},
+			Expect: "<p>a</p><p class=x>b</p>"},
+	}
+
+	for _, tcase := range tests {
+		t.Run(tcase.Name, func(t *testing.T) {
+			out, err := New(tcase.Opts...).Bytes(tcase.Path, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(out) != tcase.Expect {
+				t.Errorf("expected %q but got %q", tcase.Expect, string(out))
+			}
+		})
+	}
+}
+
+func TestGzip(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		Name    string
+		Content string
+		Sidecar bool
+	}{
+		{Name: "large.html", Content: strings.Repeat("<p>hello</p>", 100), Sidecar: true},
+		{Name: "small.html", Content: "<p>hello</p>", Sidecar: false},
+		{Name: "large.png", Content: strings.Repeat("x", 2000), Sidecar: false},
+	}
+
+	m := New(WithGzip(512))
+
+	for _, tcase := range tests {
+		path := filepath.Join(dir, tcase.Name)
+
+		f, err := m.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = f.Write([]byte(tcase.Content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gzF, err := os.Open(path + ".gz")
+		if !tcase.Sidecar {
+			if err == nil {
+				gzF.Close()
+				t.Errorf("%s: expected no sidecar", tcase.Name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: expected sidecar: %s", tcase.Name, err)
+		}
+		defer gzF.Close()
+
+		r, err := gzip.NewReader(gzF)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plain, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(out) != string(plain) {
+			t.Errorf("%s: expected sidecar to contain the minified file", tcase.Name)
+		}
+	}
+}